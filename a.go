@@ -0,0 +1,115 @@
+// a.go: embedding API
+
+package snoc
+
+import (
+	"context"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// EvalString evaluates the forms in src as top-level forms in the current
+// namespace, and returns the value of the last one.
+// Errors, including syntax errors and ctx being done, are returned;
+// they never panic out of EvalString.  A Terp is not safe for concurrent use.
+func (terp *Terp) EvalString(ctx context.Context, src string) (Any, error) {
+	return terp.run(ctx, func() Any {
+		return Load(terp, strings.NewReader(src), "*eval*")
+	})
+}
+
+// Call calls the function with the name in the current namespace,
+// converting args with FromGo.
+func (terp *Terp) Call(ctx context.Context, name string, args ...interface{}) (Any, error) {
+	return terp.run(ctx, func() Any {
+		env := &Env{Terp: terp}
+		fn := Eval(Intern(name), env)
+		vals := make([]Any, len(args))
+		for i, a := range args {
+			vals[i] = FromGo(a)
+		}
+		return ApplyValues(fn, vals, env)
+	})
+}
+
+// Set defines a global in the current namespace, converting value with FromGo.
+func (terp *Terp) Set(name string, value interface{}) {
+	terp.NS.Globals[Intern(name)] = FromGo(value)
+}
+
+// Get looks up a global in the current namespace.
+func (terp *Terp) Get(name string) (Any, bool) {
+	return terp.NS.Lookup(Intern(name))
+}
+
+// run calls f, returning any panic as an error.
+// It may be nested, as when a Go func called from snoc calls back.
+// The outermost one starts counting Used from zero.
+func (terp *Terp) run(ctx context.Context, f func() Any) (z Any, err error) {
+	depth, calls, saved := len(terp.Stack), terp.Used.Depth, terp.ctx
+	if terp.runs == 0 {
+		terp.Used = Usage{}
+	}
+	terp.ctx = ctx
+	terp.runs++
+	defer func() {
+		terp.ctx = saved
+		terp.runs--
+		if r := recover(); r != nil {
+			stack := terp.Stack
+			z, err = nil, terp.ErrorFrom(r)
+			terp.Stack, terp.Used.Depth = stack[:depth], calls
+		}
+	}()
+	return f(), nil
+}
+
+// Decode converts a snoc value into the Go value that ptr points to,
+// like ToGo.  Maps and property lists decode into structs.
+func Decode(x Any, ptr interface{}) (err error) {
+	v := reflect.ValueOf(ptr)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return fmt.Errorf("Decode needs a non-nil pointer, but got %T", ptr)
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	v.Elem().Set(ToGo(x, v.Elem().Type(), nil))
+	return nil
+}
+
+// Unmarshal evaluates snoc source in a new Terp, such as a configuration file,
+// and decodes the value of the last form into the Go value that ptr points to.
+// Struct fields are named by keywords, or by tags like `snoc:"name"`.
+func Unmarshal(src []byte, ptr interface{}) error {
+	z, err := NewTerp().EvalString(context.Background(), string(src))
+	if err != nil {
+		return err
+	}
+	return Decode(z, ptr)
+}
+
+// Marshal writes a Go value as readable snoc source, which Unmarshal reads back.
+// Slices become vectors and structs become hashes,
+// omitting fields tagged like `snoc:",omitempty"` if they are zero.
+// Snoc symbols and lists in it are quoted, and values that cannot be
+// read back, such as records and funcs, are errors.
+func Marshal(x interface{}) (src []byte, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			if e, ok := r.(error); ok {
+				err = e
+			} else {
+				err = fmt.Errorf("%v", r)
+			}
+		}
+	}()
+	return []byte(PP(fromGo(x, true, 0), DefaultWidth) + "\n"), nil
+}
@@ -0,0 +1,285 @@
+package snoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestEmbedding(t *testing.T) {
+	ctx := context.Background()
+	terp := NewTerp()
+	boom := errors.New("boom")
+	terp.RegisterFunc("go-fail", func() error { return boom })
+	terp.RegisterFunc("go-panic", func() { panic("oh no") })
+	terp.RegisterFunc("go-eval", func(src string) (Any, error) { return terp.EvalString(ctx, src) })
+
+	if z, err := terp.EvalString(ctx, `(defun add (a b) (+ a b)) (add 1 2)`); err != nil || Stringify(z) != "3" {
+		t.Errorf("EvalString got %v, %v", z, err)
+	}
+	if z, err := terp.Call(ctx, "add", 3, 4.5); err != nil || z != 7.5 {
+		t.Errorf("Call got %v, %v", z, err)
+	}
+
+	terp.Set("limit", 10)
+	terp.Set("names", []string{"a", "b"})
+	if z, err := terp.EvalString(ctx, `(list limit names)`); err != nil || Stringify(z) != "(10 (a b))" {
+		t.Errorf("Set got %v, %v", z, err)
+	}
+	if z, ok := terp.Get("limit"); !ok || z != 10.0 {
+		t.Errorf("Get got %v, %v", z, ok)
+	}
+	if _, ok := terp.Get("nowhere"); ok {
+		t.Errorf("Get found nowhere")
+	}
+
+	failures := []struct {
+		src  string
+		want string
+	}{
+		{`(head 3)`, "*eval*:1:1: cannot Head 3"},
+		{`(list 1`, "*eval*:1:1: incomplete form"},
+		{`(go-fail)`, "*eval*:1:1: boom, returned by go-fail"},
+		{`(go-panic)`, "*eval*:1:1: oh no"},
+		{`(fn (x) x)`, "fn is only supported inside defun"},
+		{`(defun cc () (call/cc (fn (k) (head 4)))) (cc)`, "cannot Head 4"},
+		{`(go-eval "(tail 5)")`, "*eval*:1:1: cannot Tail 5"},
+	}
+	for _, f := range failures {
+		z, err := terp.EvalString(ctx, f.src)
+		if err == nil || !strings.Contains(err.Error(), f.want) {
+			t.Errorf("For %s, got %v, %v, wanted error %q", f.src, z, err, f.want)
+		}
+	}
+	if _, err := terp.EvalString(ctx, `(go-fail)`); !errors.Is(err, boom) {
+		t.Errorf("Got %v, wanted boom", err)
+	}
+	if _, err := terp.EvalString(ctx, `(list 1`); !errors.Is(err, ErrIncomplete) {
+		t.Errorf("Got %v, wanted ErrIncomplete", err)
+	}
+	if _, err := terp.Call(ctx, "nowhere"); err == nil {
+		t.Errorf("Call of undefined did not fail")
+	}
+
+	canceled, cancel := context.WithCancel(ctx)
+	cancel()
+	if _, err := terp.Call(canceled, "add", 1, 2); !errors.Is(err, context.Canceled) {
+		t.Errorf("Got %v, wanted context.Canceled", err)
+	}
+	if len(terp.Stack) != 0 {
+		t.Errorf("Stack was not cleared: %v", terp.Stack)
+	}
+	if z, err := terp.Call(ctx, "add", 1, 2); err != nil || z != 3.0 {
+		t.Errorf("After errors, Call got %v, %v", z, err)
+	}
+}
+
+func TestDecode(t *testing.T) {
+	type Server struct {
+		Host  string
+		Port  int
+		Tags  []string
+		Debug bool
+	}
+	terp := NewTerp()
+	z, err := terp.EvalString(context.Background(), `{:host "example.com" :port 8080 :tags (list "a" "b") :debug true}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got Server
+	if err := Decode(z, &got); err != nil {
+		t.Fatal(err)
+	}
+	if got.Host != "example.com" || got.Port != 8080 || len(got.Tags) != 2 || !got.Debug {
+		t.Errorf("Decoded %+v", got)
+	}
+
+	var plist Server
+	if err := Decode(ParseText(`(:port 1 :debug ())`, "plist")[0], &plist); err != nil || plist.Port != 1 || plist.Debug {
+		t.Errorf("Decoded %+v, %v", plist, err)
+	}
+	if err := Decode(ParseText(`{:port "x"}`, "bad")[0], &got); err == nil {
+		t.Errorf("Decode of a string port did not fail")
+	}
+	if err := Decode(NIL, got); err == nil {
+		t.Errorf("Decode into a non-pointer did not fail")
+	}
+}
+
+type testConfig struct {
+	Name    string            `snoc:"name"`
+	Port    int               `snoc:"port"`
+	Hosts   []string          `snoc:"hosts"`
+	Limits  map[string]int    `snoc:"limits,omitempty"`
+	Backup  *testConfig       `snoc:"backup,omitempty"`
+	Secret  string            `snoc:"-"`
+	Comment string            `snoc:",omitempty"`
+	Extra   map[string]string `snoc:"extra"`
+}
+
+func TestUnmarshal(t *testing.T) {
+	src := `
+		; Computed, not just data.
+		(defun port-for (n) (+ 8000 n))
+		{:name "web"
+		 :port (port-for 80)
+		 :hosts ["a.example.com" "b.example.com"]
+		 :limits {"cpu" 2 "mem" 512}
+		 :backup (list :name "spare" :port 9000)
+		 :Comment "hi"
+		 :extra {}}
+	`
+	var cfg testConfig
+	if err := Unmarshal([]byte(src), &cfg); err != nil {
+		t.Fatal(err)
+	}
+	if cfg.Name != "web" || cfg.Port != 8080 || len(cfg.Hosts) != 2 || cfg.Limits["mem"] != 512 ||
+		cfg.Backup == nil || cfg.Backup.Name != "spare" || cfg.Backup.Port != 9000 || cfg.Comment != "hi" {
+		t.Errorf("Unmarshaled %+v", cfg)
+	}
+
+	for _, bad := range []string{`{:secret "x"}`, `{:port 1.5}`, `{:name`, `(head 1)`} {
+		if err := Unmarshal([]byte(bad), &cfg); err == nil {
+			t.Errorf("Unmarshal of %s did not fail", bad)
+		}
+	}
+
+	cfg.Secret = "shh"
+	src2, err := Marshal(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{:name "web"
+ :port 8080
+ :hosts ["a.example.com" "b.example.com"]
+ :limits {"cpu" 2 "mem" 512}
+ :backup {:name "spare" :port 9000 :hosts () :extra {}}
+ :Comment "hi"
+ :extra {}}
+`
+	if string(src2) != want {
+		t.Errorf("Marshaled\n%s\nwanted\n%s", src2, want)
+	}
+	var again testConfig
+	if err := Unmarshal(src2, &again); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Secret = ""
+	if Stringify(FromGo(again)) != Stringify(FromGo(cfg)) {
+		t.Errorf("Round trip got %+v, wanted %+v", again, cfg)
+	}
+
+	if _, err := Marshal(make(chan int)); err == nil {
+		t.Errorf("Marshal of a chan did not fail")
+	}
+}
+
+// TestParallelTerps is most useful with go test -race.
+func TestParallelTerps(t *testing.T) {
+	var wg sync.WaitGroup
+	errs := make([]error, 8)
+	for i := range errs {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				name := fmt.Sprint("shared", j%10, "-", i, j)
+				if Intern(name) != Intern(name) || InternKeyword(name) != InternKeyword(name) {
+					errs[i] = fmt.Errorf("interned %s twice", name)
+					return
+				}
+			}
+			terp := NewTerp()
+			terp.RegisterFunc("id", func() int { return i })
+			terp.Set("x", i)
+			// Each defines its own head, and interns new symbols and keywords.
+			src := fmt.Sprintf(`
+				(defun head (x) (quote shadowed))
+				(defun f%d (n) (if (< n 1) (list) (cons (string->keyword "k%d") (f%d (- n 1)))))
+				(list (id) x (head 1) (length (f%d 50)) (core/head (list 1)))
+			`, i, i, i, i)
+			z, err := terp.EvalString(context.Background(), src)
+			if want := fmt.Sprintf("(%d %d shadowed 50 1)", i, i); err == nil && Stringify(z) != want {
+				err = fmt.Errorf("got %v, wanted %s", z, want)
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+	for i, err := range errs {
+		if err != nil {
+			t.Errorf("Terp %d: %v", i, err)
+		}
+	}
+}
+
+// TestSharedTables checks that what Terps share cannot be changed
+// from outside.
+func TestSharedTables(t *testing.T) {
+	head := BuiltinPrims["head"]
+	defer func() { BuiltinPrims["head"] = head }()
+	BuiltinPrims["head"] = func(args []Any, env *Env) Any { return "changed" }
+	if z, err := NewTerp().EvalString(context.Background(), `(head (list 1 2))`); z != 1.0 || err != nil {
+		t.Errorf("Got %v, %v, wanted 1", z, err)
+	}
+
+	table := InternTable()
+	if table["head"] != Intern("head") {
+		t.Errorf("InternTable lacks head")
+	}
+	delete(table, "head")
+	table["not-interned"] = &Sym{S: "not-interned"}
+	if InternTable()["head"] == nil || Intern("not-interned") == table["not-interned"] {
+		t.Errorf("Changing the InternTable copy changed the symbols")
+	}
+	if k := InternKeyword("k"); KeywordTable()["k"] != k {
+		t.Errorf("KeywordTable lacks :k")
+	}
+}
+
+type testCommand struct {
+	Tag  Any
+	Args []Any
+	Opts map[string]Any
+}
+
+func TestMarshalData(t *testing.T) {
+	cmd := testCommand{
+		Tag:  Intern("prod"),
+		Args: []Any{ParseText("(x 1 [y])", "TestMarshalData")[0], NIL, TRUE, InternKeyword("k")},
+		Opts: map[string]Any{"v": &Vec{V: []Any{Intern("a"), 2.0}}, "h": NewHash([]Any{Intern("b"), ParseText("(c)", "h")[0]})},
+	}
+	src, err := Marshal(cmd)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := `{:Tag (quote prod)
+ :Args [(quote (x 1 [y])) () true :k]
+ :Opts {"h" {(quote b) (quote (c))} "v" [(quote a) 2]}}
+`
+	if string(src) != want {
+		t.Errorf("Marshaled\n%s\nwanted\n%s", src, want)
+	}
+	var again testCommand
+	if err := Unmarshal(src, &again); err != nil {
+		t.Fatal(err)
+	}
+	if got, want := Stringify(FromGo(again)), Stringify(FromGo(cmd)); got != want {
+		t.Errorf("Round trip got %s, wanted %s", got, want)
+	}
+
+	terp := NewTerp()
+	point, err := terp.EvalString(context.Background(), `(defstruct point x y) (make-point 1 2)`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	fn, _ := terp.Get("head")
+	for _, bad := range []Any{point, fn, VecToList([]Any{Intern("a"), point}), &Vec{V: []Any{fn}}} {
+		if src, err := Marshal(testCommand{Tag: bad}); err == nil {
+			t.Errorf("Marshal of %v did not fail, but wrote %s", bad, src)
+		}
+	}
+}
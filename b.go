@@ -3,16 +3,20 @@
 package snoc
 
 import (
-	"log"
 	"math"
+	"os"
+	"sort"
 	"strconv"
+	"strings"
 	"sync/atomic"
+	"text/scanner"
 
 	. "github.com/strickyak/yak"
 )
 
-var serial int64
+var serial int64 // Shared by all Terps, but only used atomically.
 
+// Serial makes a name that is unique in the process, like "FN_12".
 func Serial(prefix string) string {
 	return prefix + strconv.FormatInt(atomic.AddInt64(&serial, 1), 10)
 }
@@ -110,6 +114,11 @@ func LispyBool(b bool) Any {
 
 type ContinuationUsed string // for exiting thread.
 
+// threadPanic carries a panic in the thread of call/cc back to its caller.
+type threadPanic struct {
+	r interface{}
+}
+
 func CallCC(args []Any, env *Env) Any {
 	MustLen(args, 1)
 	ch := make(chan Any)
@@ -118,7 +127,8 @@ func CallCC(args []Any, env *Env) Any {
 			r := recover()
 			if r != nil {
 				if _, ok := r.(ContinuationUsed); !ok {
-					log.Fatalf("ERROR in thread: %v", r)
+					ch <- threadPanic{r}
+					close(ch)
 				}
 			}
 		}()
@@ -135,7 +145,11 @@ func CallCC(args []Any, env *Env) Any {
 		ch <- Apply(args[0], []Any{continuation}, env)
 		close(ch)
 	}()
-	return <-ch
+	z := <-ch
+	if p, ok := z.(threadPanic); ok {
+		panic(p.r)
+	}
+	return z
 }
 
 var BuiltinPrims = map[string]func([]Any, *Env) Any{
@@ -177,15 +191,15 @@ var BuiltinPrims = map[string]func([]Any, *Env) Any{
 	},
 	"3rd": func(args []Any, env *Env) Any {
 		MustLen(args, 1)
-		return Head(Head(Tail(args[0])))
+		return Head(Tail(Tail(args[0])))
 	},
 	"4th": func(args []Any, env *Env) Any {
 		MustLen(args, 1)
-		return Head(Head(Tail(Tail(args[0]))))
+		return Head(Tail(Tail(Tail(args[0]))))
 	},
 	"5th": func(args []Any, env *Env) Any {
 		MustLen(args, 1)
-		return Head(Head(Tail(Tail(Tail(args[0])))))
+		return Head(Tail(Tail(Tail(Tail(args[0])))))
 	},
 	"eval": func(args []Any, env *Env) Any {
 		MustLen(args, 1)
@@ -225,27 +239,204 @@ var BuiltinPrims = map[string]func([]Any, *Env) Any{
 		}
 		return product
 	},
+	// (length list) counts the elements.
+	"length": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(len(ListToVec(args[0])))
+	},
+	// (reverse list) makes a new list in the opposite order.
+	"reverse": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ListToVec(args[0])
+		Alloc(env, len(v))
+		z := NIL
+		for _, e := range v {
+			z = Snoc(z, e)
+		}
+		return z
+	},
+	// (append list...) makes one list of the elements of all the lists.
+	// It shares the last list rather than copying it.
+	"append": func(args []Any, env *Env) Any {
+		if len(args) == 0 {
+			return NIL
+		}
+		z, ok := args[len(args)-1].(*Pair)
+		if !ok {
+			Throw(args[len(args)-1], "cannot Append")
+		}
+		for i := len(args) - 2; i >= 0; i-- {
+			v := ListToVec(args[i])
+			Alloc(env, len(v))
+			for j := len(v) - 1; j >= 0; j-- {
+				z = Snoc(z, v[j])
+			}
+		}
+		return z
+	},
+	// (nth list i) is the element at index i, counting from 0.
+	"nth": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		v := ListToVec(args[0])
+		return v[ToIndex(args[1], len(v))]
+	},
+	// (last list) is the final element.
+	"last": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ListToVec(args[0])
+		if len(v) == 0 {
+			Throw(args[0], "cannot Last")
+		}
+		return v[len(v)-1]
+	},
+	// (range end), (range start end), or (range start end step)
+	// lists the numbers from start up to but not including end.
+	"range": func(args []Any, env *Env) Any {
+		start, end, step := 0.0, 0.0, 1.0
+		switch len(args) {
+		case 1:
+			end = ToFloat(args[0])
+		case 2:
+			start, end = ToFloat(args[0]), ToFloat(args[1])
+		case 3:
+			start, end, step = ToFloat(args[0]), ToFloat(args[1]), ToFloat(args[2])
+		default:
+			Throw(VecToList(args), "range wants 1 to 3 args, but got")
+		}
+		if step == 0 {
+			Throw(VecToList(args), "range step cannot be zero:")
+		}
+		// Count first, and multiply, so rounding errors do not add up.
+		n := math.Ceil((end - start) / step)
+		if !(n > 0) {
+			return NIL
+		}
+		Alloc(env, int(math.Min(n, math.MaxInt32)))
+		if n > math.MaxInt32 {
+			Throw(VecToList(args), "range is too long:")
+		}
+		v := make([]Any, int(n))
+		for i := range v {
+			v[i] = start + float64(i)*step
+		}
+		return VecToList(v)
+	},
+	// (sort list) makes a new list ordered by compare.
+	// (sort list less) orders it by the function less instead.
+	// The sort is stable.
+	"sort": func(args []Any, env *Env) Any {
+		Must(len(args) == 1 || len(args) == 2)
+		v := ListToVec(args[0])
+		Alloc(env, len(v))
+		less := func(i, j int) bool { return Compare(v[i], v[j]) < 0 }
+		if len(args) == 2 {
+			less = func(i, j int) bool { return Bool(ApplyValues(args[1], []Any{v[i], v[j]}, env)) }
+		}
+		sort.SliceStable(v, less)
+		return VecToList(v)
+	},
+}
+
+// BuiltinPurePrims names the BuiltinPrims that the optimizer may fold.
+var BuiltinPurePrims = map[string]bool{
+	"null?":   true,
+	"atom?":   true,
+	"eq":      true,
+	"sum":     true,
+	"product": true,
+	"length":  true,
+
+	"keyword?":        true,
+	"keyword->string": true,
+	"string->keyword": true,
+	"keyword->symbol": true,
+	"symbol->keyword": true,
+}
+
+// builtins are what NewTerp puts in core, copied once from the Builtin
+// maps and Prelude when the package is initialized.  Changing those later
+// does not change new Terps, which share no mutable package state.
+var builtins = copyBuiltins()
+
+type builtinSet struct {
+	specials  map[string]func([]Any, *Env) Any
+	prims     map[string]func([]Any, *Env) Any
+	pure      map[string]bool
+	binaryOps map[string]func(float64, float64) float64
+	relOps    map[string]func(float64, float64) bool
+	prelude   string
+}
+
+func copyBuiltins() *builtinSet {
+	b := &builtinSet{
+		specials:  make(map[string]func([]Any, *Env) Any),
+		prims:     make(map[string]func([]Any, *Env) Any),
+		pure:      make(map[string]bool),
+		binaryOps: make(map[string]func(float64, float64) float64),
+		relOps:    make(map[string]func(float64, float64) bool),
+		prelude:   Prelude,
+	}
+	for _, specials := range []map[string]func([]Any, *Env) Any{
+		BuiltinSpecials,
+		BuiltinRecordSpecials,
+		BuiltinModuleSpecials,
+		BuiltinGoSpecials,
+	} {
+		for k, fn := range specials {
+			b.specials[k] = fn
+		}
+	}
+	for _, prims := range []map[string]func([]Any, *Env) Any{
+		BuiltinPrims,
+		BuiltinVectorPrims,
+		BuiltinHashPrims,
+		BuiltinPersistentPrims,
+		BuiltinEqualityPrims,
+		BuiltinStringPrims,
+		BuiltinOutputPrims,
+		BuiltinPrettyPrims,
+		BuiltinKeywordPrims,
+		BuiltinLoadPrims,
+	} {
+		for k, fn := range prims {
+			b.prims[k] = fn
+		}
+	}
+	for k, pure := range BuiltinPurePrims {
+		b.pure[k] = pure
+	}
+	for k, fn := range BuiltinFloatingBinaryOps {
+		b.binaryOps[k] = fn
+	}
+	for k, fn := range BuiltinFloatingRelOps {
+		b.relOps[k] = fn
+	}
+	return b
 }
 
+// NewTerp makes an interpreter with the builtins and the prelude.
+// Each Terp has its own globals, namespaces, and stack, so Terps may be
+// made and used in parallel, each by one goroutine at a time.
+// Only symbols and keywords are shared, in tables that are safe for that.
 func NewTerp() *Terp {
 	globals := make(map[*Sym]Any)
 
-	for k, fn := range BuiltinSpecials {
+	for k, fn := range builtins.specials {
 		globals[Intern(k)] = &Special{Name: k, F: fn}
 	}
-	for k, fn := range BuiltinPrims {
-		globals[Intern(k)] = &Prim{Name: k, F: fn}
+	for k, fn := range builtins.prims {
+		globals[Intern(k)] = &Prim{Name: k, F: fn, Pure: builtins.pure[k]}
 	}
-	for k, fn := range BuiltinFloatingBinaryOps {
+	for k, fn := range builtins.binaryOps {
 		k_, fn_ := k, fn // Capture an inside-loop copy.
-		globals[Intern(k_)] = &Prim{Name: k_, F: func(args []Any, env *Env) Any {
+		globals[Intern(k_)] = &Prim{Name: k_, Pure: true, F: func(args []Any, env *Env) Any {
 			MustEq(len(args), 2)
 			return fn_(args[0].(float64), args[1].(float64))
 		}}
 	}
-	for k, fn := range BuiltinFloatingRelOps {
+	for k, fn := range builtins.relOps {
 		k_, fn_ := k, fn // Capture an inside-loop copy.
-		globals[Intern(k_)] = &Prim{Name: k_, F: func(args []Any, env *Env) Any {
+		globals[Intern(k_)] = &Prim{Name: k_, Pure: true, F: func(args []Any, env *Env) Any {
 			MustEq(len(args), 2)
 			a := args[0].(float64)
 			b := args[1].(float64)
@@ -261,7 +452,20 @@ func NewTerp() *Terp {
 	globals[Intern("defun")] = DEFUN
 	globals[Intern("true")] = TRUE
 
-	return &Terp{
-		Globals: globals,
+	core := &Module{Name: "core", Globals: globals}
+	terp := &Terp{
+		Out:        os.Stdout,
+		GoComments: true,
+		Where:      make(map[*Pair]scanner.Position),
+		Path:       SnocPath(),
+		Modules:    map[string]*Module{"core": core},
+	}
+	terp.Enter(core)
+	Load(terp, strings.NewReader(builtins.prelude), "prelude.snoc")
+	for sym := range globals {
+		core.Exports = append(core.Exports, sym)
 	}
+	terp.Modules["user"] = terp.NewNamespace("user")
+	terp.Enter(terp.Modules["user"])
+	return terp
 }
@@ -0,0 +1,199 @@
+// c.go: characters and strings
+
+package snoc
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/strickyak/yak"
+)
+
+// CharNames are the names for #\name character syntax.
+var CharNames = map[string]Char{
+	"nul":       0,
+	"alarm":     7,
+	"backspace": 8,
+	"tab":       '\t',
+	"newline":   '\n',
+	"return":    '\r',
+	"escape":    27,
+	"space":     ' ',
+	"delete":    127,
+}
+
+func readChar(text string) (Char, error) {
+	body := []rune(strings.TrimPrefix(text, `#\`))
+	switch {
+	case len(body) == 1:
+		return Char(body[0]), nil
+	case len(body) > 1 && body[0] == 'x':
+		n, err := strconv.ParseUint(string(body[1:]), 16, 32)
+		if err == nil && utf8.ValidRune(rune(n)) {
+			return Char(n), nil
+		}
+	default:
+		if c, ok := CharNames[string(body)]; ok {
+			return c, nil
+		}
+	}
+	return 0, fmt.Errorf("Bad character %q", text)
+}
+
+func (o Char) String() string {
+	for name, c := range CharNames {
+		if c == o {
+			return `#\` + name
+		}
+	}
+	if unicode.IsGraphic(rune(o)) && !unicode.IsSpace(rune(o)) {
+		return `#\` + string(rune(o))
+	}
+	return fmt.Sprintf(`#\x%x`, rune(o))
+}
+
+func ToChar(o Any) Char {
+	switch t := o.(type) {
+	case Char:
+		return t
+	}
+	Throw(o, "cannot Char")
+	return 0
+}
+
+// ToRunes converts a string to runes, so operations index by rune, not byte.
+func ToRunes(o Any) []rune {
+	return []rune(ToStr(o))
+}
+
+var BuiltinStringPrims = map[string]func([]Any, *Env) Any{
+	"char?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(Char)
+		return LispyBool(ok)
+	},
+	"char->integer": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(ToChar(args[0]))
+	},
+	"integer->char": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		n := ToIndex(args[0], unicode.MaxRune+1)
+		if !utf8.ValidRune(rune(n)) {
+			Throw(args[0], "integer->char got a surrogate, not a character:")
+		}
+		return Char(n)
+	},
+	"char-upcase": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return Char(unicode.ToUpper(rune(ToChar(args[0]))))
+	},
+	"char-downcase": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return Char(unicode.ToLower(rune(ToChar(args[0]))))
+	},
+	"char-alphabetic?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return LispyBool(unicode.IsLetter(rune(ToChar(args[0]))))
+	},
+	"char-numeric?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return LispyBool(unicode.IsDigit(rune(ToChar(args[0]))))
+	},
+	"char-whitespace?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return LispyBool(unicode.IsSpace(rune(ToChar(args[0]))))
+	},
+	"string?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(string)
+		return LispyBool(ok)
+	},
+	"string-length": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(len(ToRunes(args[0])))
+	},
+	"string-ref": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		rs := ToRunes(args[0])
+		return Char(rs[ToIndex(args[1], len(rs))])
+	},
+	// (substring s start) or (substring s start end), in runes.
+	"substring": func(args []Any, env *Env) Any {
+		Must(len(args) == 2 || len(args) == 3)
+		rs := ToRunes(args[0])
+		end := len(rs)
+		if len(args) == 3 {
+			end = ToIndex(args[2], len(rs)+1)
+		}
+		start := ToIndex(args[1], end+1)
+		Alloc(env, end-start)
+		return string(rs[start:end])
+	},
+	"string-append": func(args []Any, env *Env) Any {
+		var buf strings.Builder
+		for _, a := range args {
+			s := ToStr(a)
+			Alloc(env, len(s))
+			buf.WriteString(s)
+		}
+		return buf.String()
+	},
+	"string-upcase": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		Alloc(env, len(ToStr(args[0])))
+		return strings.ToUpper(ToStr(args[0]))
+	},
+	"string-downcase": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		Alloc(env, len(ToStr(args[0])))
+		return strings.ToLower(ToStr(args[0]))
+	},
+	"string->list": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		rs := ToRunes(args[0])
+		Alloc(env, len(rs))
+		var z []Any
+		for _, r := range rs {
+			z = append(z, Char(r))
+		}
+		return VecToList(z)
+	},
+	"list->string": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ListToVec(args[0])
+		Alloc(env, len(v))
+		var buf strings.Builder
+		for _, e := range v {
+			buf.WriteRune(rune(ToChar(e)))
+		}
+		return buf.String()
+	},
+	"string->symbol": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return Intern(ToStr(args[0]))
+	},
+	"symbol->string": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		sym, ok := args[0].(*Sym)
+		if !ok {
+			Throw(args[0], "cannot Sym")
+		}
+		return sym.S
+	},
+	"number->string": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return strconv.FormatFloat(ToFloat(args[0]), 'g', -1, 64)
+	},
+	"string->number": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		f, err := strconv.ParseFloat(ToStr(args[0]), 64)
+		if err != nil {
+			return NIL
+		}
+		return f
+	},
+}
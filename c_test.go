@@ -0,0 +1,41 @@
+package snoc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCharsAndStrings(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(list #\a #\space #\x41 #\x3bb #\()`, `(#\a #\space #\A #\λ #\()`},
+		{`#\bogus`, `*ERROR* *repl*:1:1: Bad character "#\\bogus"`},
+		{`#\x110000`, `*ERROR* *repl*:1:1: Bad character "#\\x110000"`},
+		{`(char->integer "a")`, `*ERROR* *repl*:1:1: cannot Char "a"`},
+		{`(integer->char -1)`, `*ERROR* *repl*:1:1: index out of range [0, 1114112) -1`},
+		{`(integer->char 55296)`, `*ERROR* *repl*:1:1: integer->char got a surrogate, not a character: 55296`},
+		{`(list (integer->char 55295) (integer->char 57344))`, `(#\xd7ff #\xe000)`},
+		{`#\xD800`, `*ERROR* *repl*:1:1: Bad character "#\\xD800"`},
+		{`#\xdfff`, `*ERROR* *repl*:1:1: Bad character "#\\xdfff"`},
+		{`(char-upcase #\ß)`, `#\ß`},
+		{`(string-length "héllo")`, `5`},
+		{`(string-ref "héllo" 1)`, `#\é`},
+		{`(string-ref "abc" 3)`, `*ERROR* *repl*:1:1: index out of range [0, 3) 3`},
+		{`(string-ref "" 0)`, `*ERROR* *repl*:1:1: index out of range [0, 0) 0`},
+		{`(substring "héllo" 1 3)`, `él`},
+		{`(substring "abc" 3)`, ``},
+		{`(substring "abc" 2 1)`, `*ERROR* *repl*:1:1: index out of range [0, 2) 2`},
+		{`(substring "abc" 0 4)`, `*ERROR* *repl*:1:1: index out of range [0, 4) 4`},
+		{`(string-length 5)`, `*ERROR* *repl*:1:1: cannot Str 5`},
+		{`(list->string (list #\a "b"))`, `*ERROR* *repl*:1:1: cannot Char "b"`},
+		{`"abc`, `*ERROR* *repl*:1:1: incomplete form`},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
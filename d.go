@@ -6,10 +6,18 @@ import (
 	"log"
 	"runtime/debug"
 	"strings"
+	"sync"
 )
 
 //var Globals = make(map[string]Any)
-var InternTable = make(map[string]*Sym)
+
+// The symbol table is shared by all Terps, so symbols from one Terp are Eq
+// in another.  internMu makes it safe to Intern from many goroutines.
+var (
+	internMu    sync.RWMutex
+	internTable = make(map[string]*Sym)
+)
+
 var FlagVerbose = flag.Bool("v", false, "verbosity")
 
 func Log(format string, args ...interface{}) {
@@ -29,15 +37,37 @@ var (
 	TRUE  = Intern("true")  // In other Lisps, this is T or *T*.
 	DEF   = Intern("def")   // Special to the REPL; it modifies the env.
 	DEFUN = Intern("defun") // Special to the REPL; it modifies the env.
+	QUOTE = Intern("quote")
 )
 
 func Intern(s string) *Sym {
-	if z, ok := InternTable[s]; ok {
+	internMu.RLock()
+	z, ok := internTable[s]
+	internMu.RUnlock()
+	if ok {
 		return z
 	}
-	z2 := &Sym{S: s}
-	InternTable[s] = z2
-	return z2
+	internMu.Lock()
+	defer internMu.Unlock()
+	if z, ok := internTable[s]; ok {
+		return z
+	}
+	z = &Sym{S: s}
+	internTable[s] = z
+	return z
+}
+
+// InternTable returns a copy of the symbol table, by name.
+// It used to be the table itself, a variable, but that could not be
+// shared safely; changing the copy does not intern anything.
+func InternTable() map[string]*Sym {
+	internMu.RLock()
+	defer internMu.RUnlock()
+	z := make(map[string]*Sym, len(internTable))
+	for s, sym := range internTable {
+		z[s] = sym
+	}
+	return z
 }
 
 // String methods.
@@ -78,6 +108,10 @@ func (env *Env) String() string {
 }
 
 func (o *Pair) String() string {
+	return o.stringAt(0)
+}
+
+func (o *Pair) stringAt(depth int) string {
 	var buf strings.Builder
 	firstTime := true
 	buf.WriteString("(")
@@ -86,13 +120,49 @@ func (o *Pair) String() string {
 			buf.WriteByte(' ')
 		}
 		// fmt.Fprintf(&buf, "%T ", p.H)
-		buf.WriteString(Stringify(p.H))
+		buf.WriteString(stringify(p.H, depth+1))
 		firstTime = false
 	}
 	buf.WriteString(")")
 	return buf.String()
 }
 
+func (o *Vec) String() string {
+	return o.stringAt(0)
+}
+
+func (o *Vec) stringAt(depth int) string {
+	var buf strings.Builder
+	buf.WriteString("[")
+	for i, e := range o.V {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(stringify(e, depth+1))
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+func (o *Hash) String() string {
+	return o.stringAt(0)
+}
+
+func (o *Hash) stringAt(depth int) string {
+	var buf strings.Builder
+	buf.WriteString("{")
+	for i, k := range o.Keys {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(stringify(k, depth+1))
+		buf.WriteByte(' ')
+		buf.WriteString(stringify(o.M[k], depth+1))
+	}
+	buf.WriteString("}")
+	return buf.String()
+}
+
 func (o *Sym) String() string {
 	return o.S
 }
@@ -141,10 +211,18 @@ func Eq(o Any, a Any) bool {
 		if b, ok := a.(*Sym); ok {
 			return t == b
 		}
+	case *Keyword:
+		if b, ok := a.(*Keyword); ok {
+			return t == b
+		}
 	case string:
 		if b, ok := a.(string); ok {
 			return t == b
 		}
+	case Char:
+		if b, ok := a.(Char); ok {
+			return t == b
+		}
 	case int:
 		if b, ok := a.(int); ok {
 			return t == b
@@ -157,15 +235,37 @@ func Eq(o Any, a Any) bool {
 		if b, ok := a.(*Pair); ok {
 			return t == b
 		}
+	case *Vec:
+		if b, ok := a.(*Vec); ok {
+			return t == b
+		}
+	case *Hash:
+		if b, ok := a.(*Hash); ok {
+			return t == b
+		}
+	case *PMap:
+		if b, ok := a.(*PMap); ok {
+			return t == b
+		}
+	case *PVec:
+		if b, ok := a.(*PVec); ok {
+			return t == b
+		}
+	case *Record:
+		if b, ok := a.(*Record); ok {
+			return t == b
+		}
 	}
 	return false
 }
 func Snoc(o *Pair, a Any) *Pair {
 	return &Pair{H: a, T: o}
 }
-func Get(o *Pair, key *Sym) (Any, bool) {
-	for o != NIL {
-		if o.H.(*Sym) == key {
+
+// Get looks up a key in a property list like (:a 1 :b 2).
+func Get(o *Pair, key *Keyword) (Any, bool) {
+	for o != NIL && o.T != NIL {
+		if o.H == key {
 			return o.T.H, true
 		}
 		o = o.T.T
@@ -205,23 +305,42 @@ func Bool(o Any) bool {
 }
 
 func Stringify(o Any) string {
+	return stringify(o, 0)
+}
+
+// stringify is Stringify at depth within data.
+func stringify(o Any, depth int) string {
+	nested(depth)
 	switch t := o.(type) {
 	case *Pair:
-		return t.String()
+		return t.stringAt(depth)
 	case *Sym:
 		return t.String()
+	case *Keyword:
+		return t.String()
+	case *Vec:
+		return t.stringAt(depth)
+	case *Hash:
+		return t.stringAt(depth)
+	case *PMap:
+		return t.stringAt(depth)
+	case *PVec:
+		return t.stringAt(depth)
+	case *Record:
+		return t.stringAt(depth)
+	case Char:
+		return t.String()
 	}
 	return fmt.Sprintf("%v", o)
 }
 
+// Throw panics with an *Error about o, like "cannot Head 3".
+// The REPL adds where it happened; see Terp.ErrorFrom.
 func Throw(o Any, format string, args ...interface{}) Any {
-	debug.PrintStack()
-	var v []interface{}
-	v = append(v, o)
-	v = append(v, o)
-	v = append(v, args...)
-	log.Panicf("Exception on (%T) %v: "+format, v...)
-	return NIL
+	if *FlagVerbose {
+		debug.PrintStack()
+	}
+	panic(&Error{Msg: fmt.Sprintf(format, args...) + " " + Write(o)})
 }
 
 func Eval(o Any, env *Env) Any {
@@ -232,6 +351,11 @@ SWITCH:
 	case nil:
 		panic("cannot Eval golang nil")
 	case *ProtoFunc:
+		ns := t.NS
+		if ns == nil {
+			ns = env.Namespace()
+		}
+		Alloc(env, 1)
 		z = &Func{
 			Proto:  t,
 			Outer:  env,      // TODO WRONG?
@@ -240,7 +364,38 @@ SWITCH:
 			Body:   t.Body,   // omit
 			Name:   t.Name,   // omit
 			IsLet:  t.IsLet,  // omit
+			NS:     ns,
+		}
+	case *Guard:
+		z = Eval(t.Choose(env.Namespace().Globals), env)
+	case *Vec:
+		Alloc(env, len(t.V))
+		vec := make([]Any, len(t.V))
+		for i, e := range t.V {
+			vec[i] = Eval(e, env)
+		}
+		z = &Vec{V: vec}
+	case *Hash:
+		Alloc(env, len(t.Keys))
+		h := NewHash(nil)
+		for _, k := range t.Keys {
+			h.Set(CheckKey(Eval(k, env)), Eval(t.M[k], env))
+		}
+		z = h
+	case *PVec:
+		Alloc(env, t.Count)
+		xs := t.ToSlice()
+		for i, e := range xs {
+			xs[i] = Eval(e, env)
 		}
+		z = pvecConj(EmptyPVec, xs)
+	case *PMap:
+		Alloc(env, t.Count)
+		var kvs []Any
+		t.Each(func(k, v Any) {
+			kvs = append(kvs, Eval(k, env), Eval(v, env))
+		})
+		z = pmapAssoc(EmptyPMap, kvs)
 	case *Var:
 		{
 			for p := env; p != nil; p = p.Up {
@@ -249,14 +404,14 @@ SWITCH:
 					break SWITCH
 				}
 			}
-			Throw(o, "cannot Eval Var: %v", t)
+			Throw(o, "cannot Eval Var")
 		}
 	case *Sym:
 		{
-			g, ok := env.Terp.Globals[t]
+			g, ok := env.Namespace().Lookup(t)
 			// log.Printf("Globals %q --> (%T) %v, ok=%v", t.S, g, g, ok)
 			if !ok {
-				Throw(o, "cannot Eval symbol %q with globals %v", t.S, env.Terp.Globals)
+				Throw(o, "cannot Eval symbol")
 			}
 			z = g
 		}
@@ -272,7 +427,19 @@ SWITCH:
 			}
 			z = EvalLambda(ListToVec(t.T.H), t.T.T.H, env)
 		default:
+			terp := env.Terp
+			if terp.ctx != nil {
+				select {
+				case <-terp.ctx.Done():
+					panic(&Error{Msg: terp.ctx.Err().Error(), Err: terp.ctx.Err()})
+				default:
+				}
+			}
+			terp.step()
+			depth := len(terp.Stack)
+			terp.Stack = append(terp.Stack, Frame{Form: t})
 			z = Apply(Eval(t.H, env), ListToVec(t.T), env)
+			terp.Stack = terp.Stack[:depth]
 		}
 	}
 
@@ -286,9 +453,17 @@ SWITCH:
 	return z
 }
 
+// Namespace is where symbols are looked up in env.
+func (env *Env) Namespace() *Module {
+	if env.NS != nil {
+		return env.NS
+	}
+	return env.Terp.NS
+}
+
 func EvalLambda(params []Any, body Any, env *Env) Any {
-	log.Fatalf("STOP EvalLambda")
-	return nil
+	// Only fn inside defun is preprocessed into a ProtoFunc.
+	return Throw(VecToList(params), "fn is only supported inside defun, but got fn")
 	/*
 		pp := make([]*Sym, len(params))
 		for i, e := range params {
@@ -326,11 +501,20 @@ func Apply(o Any, args []Any, env *Env) Any {
 	return z
 }
 
+// ApplyValues is like Apply, but the args have already been evaluated.
+func ApplyValues(o Any, args []Any, env *Env) Any {
+	quoted := make([]Any, len(args))
+	for i, a := range args {
+		quoted[i] = Snoc(Snoc(NIL, a), QUOTE)
+	}
+	return Apply(o, quoted, env)
+}
+
 func ApplyFunc(o *Func, args []Any, env *Env) Any {
 	Log("ApplyFunc << %v << %v << %v", o, args, env)
 	if o.IsLet {
 		if args != nil {
-			Throw(o, "apply: got %d args but wanted none because it has Let Values")
+			Throw(o, "apply: got %d args but wanted none because it has Let Values", len(args))
 		}
 	} else {
 		if len(args) != len(o.Params) {
@@ -338,6 +522,7 @@ func ApplyFunc(o *Func, args []Any, env *Env) Any {
 		}
 	}
 
+	Alloc(env, len(o.Params)+1)
 	slots := make([]Any, len(o.Params))
 	for i, v := range args { // For the FN case.
 		slots[i] = Eval(v, env)
@@ -348,6 +533,20 @@ func ApplyFunc(o *Func, args []Any, env *Env) Any {
 		Proto: o.Proto,
 		Slots: slots,
 		Terp:  env.Terp,
+		NS:    o.NS,
+	}
+
+	terp := env.Terp
+	depth, calls := len(terp.Stack), terp.Used.Depth
+	switch {
+	case o.IsLet || strings.HasPrefix(o.Name, "LET_"):
+		// Parts of a let are not calls.
+	case strings.HasPrefix(o.Name, "FN_"):
+		terp.Stack = append(terp.Stack, Frame{Name: "fn", Where: o.Proto.Where})
+		terp.enter()
+	default:
+		terp.Stack = append(terp.Stack, Frame{Name: o.Name, Where: o.Proto.Where})
+		terp.enter()
 	}
 
 	var z Any
@@ -368,11 +567,13 @@ func ApplyFunc(o *Func, args []Any, env *Env) Any {
 	} else {
 		z = Eval(o.Body, env2)
 	}
+	terp.Stack, terp.Used.Depth = terp.Stack[:depth], calls
 	Log("ApplyFunc >> %v", z)
 	return z
 }
 
 func ApplyPrim(o *Prim, args []Any, env *Env) Any { // args are unevaluted.
+	Alloc(env, len(args))
 	evalledArgs := make([]Any, len(args))
 	for i, a := range args {
 		evalledArgs[i] = Eval(a, env)
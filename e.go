@@ -0,0 +1,347 @@
+// e.go: structural equality, ordering, and hashing
+
+package snoc
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/fnv"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+
+	. "github.com/strickyak/yak"
+)
+
+// IsNumber reports whether o is a number, and its value as float64.
+func IsNumber(o Any) (float64, bool) {
+	switch t := o.(type) {
+	case float64:
+		return t, true
+	case int:
+		return float64(t), true
+	}
+	return 0, false
+}
+
+// Equal is deep equality over all built-in types.
+// Unlike Eq, it compares lists, vectors, maps and records by contents,
+// numbers by value (so 1 and 1.0 are Equal), and NaN is Equal to NaN.
+func Equal(o Any, a Any) bool {
+	return equal(o, a, 0)
+}
+
+// equal is Equal at depth within data.
+func equal(o Any, a Any, depth int) bool {
+	nested(depth)
+	if x, ok := IsNumber(o); ok {
+		y, ok := IsNumber(a)
+		return ok && (x == y || x != x && y != y)
+	}
+	switch t := o.(type) {
+	case string:
+		b, ok := a.(string)
+		return ok && t == b
+	case *Pair:
+		b, ok := a.(*Pair)
+		if !ok {
+			return false
+		}
+		for t != NIL && b != NIL {
+			if !equal(t.H, b.H, depth+1) {
+				return false
+			}
+			t, b = t.T, b.T
+		}
+		return t == b
+	case *Vec:
+		b, ok := a.(*Vec)
+		return ok && equalSlices(t.V, b.V, depth+1)
+	case *PVec:
+		b, ok := a.(*PVec)
+		return ok && t.Count == b.Count && equalSlices(t.ToSlice(), b.ToSlice(), depth+1)
+	case *Hash:
+		b, ok := a.(*Hash)
+		if !ok || len(t.Keys) != len(b.Keys) {
+			return false
+		}
+		for _, k := range t.Keys {
+			if v, ok := b.Get(k); !ok || !equal(t.M[k], v, depth+1) {
+				return false
+			}
+		}
+		return true
+	case *PMap:
+		b, ok := a.(*PMap)
+		if !ok || t.Count != b.Count {
+			return false
+		}
+		z := true
+		t.Each(func(k, v Any) {
+			if v2, ok := b.Get(k); !ok || !equal(v, v2, depth+1) {
+				z = false
+			}
+		})
+		return z
+	case *Record:
+		b, ok := a.(*Record)
+		return ok && t.Type == b.Type && equalSlices(t.Vals, b.Vals, depth+1)
+	}
+	ta := reflect.TypeOf(o)
+	return ta != nil && ta == reflect.TypeOf(a) && ta.Comparable() && o == a
+}
+
+func equalSlices(a, b []Any, depth int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i, e := range a {
+		if !equal(e, b[i], depth) {
+			return false
+		}
+	}
+	return true
+}
+
+// typeRank orders values of different types for Compare.
+func typeRank(o Any) int {
+	if _, ok := IsNumber(o); ok {
+		return 0
+	}
+	switch o.(type) {
+	case Char:
+		return 1
+	case string:
+		return 2
+	case *Sym:
+		return 3
+	case *Keyword:
+		return 4
+	case *Pair:
+		return 5
+	case *Vec:
+		return 6
+	case *PVec:
+		return 7
+	case *Hash:
+		return 8
+	case *PMap:
+		return 9
+	case *Record:
+		return 10
+	}
+	return 100
+}
+
+// Compare is a total order consistent with Equal:
+// it returns -1, 0, or 1, and 0 only if Equal.
+// Different types are ordered by a fixed ranking of the types.
+// NaN sorts before all other numbers.
+func Compare(o Any, a Any) int {
+	return compare(o, a, 0)
+}
+
+// compare is Compare at depth within data.
+func compare(o Any, a Any, depth int) int {
+	nested(depth)
+	ro, ra := typeRank(o), typeRank(a)
+	if ro != ra {
+		return cmpInts(ro, ra)
+	}
+	if x, ok := IsNumber(o); ok {
+		y, _ := IsNumber(a)
+		switch {
+		case x != x || y != y:
+			return cmpBools(y != y, x != x) // NaN first.
+		case x < y:
+			return -1
+		case x > y:
+			return 1
+		}
+		return 0
+	}
+	switch t := o.(type) {
+	case Char:
+		return cmpInts(int(t), int(a.(Char)))
+	case string:
+		return strings.Compare(t, a.(string))
+	case *Sym:
+		return strings.Compare(t.S, a.(*Sym).S)
+	case *Keyword:
+		return strings.Compare(t.S, a.(*Keyword).S)
+	case *Pair:
+		return compareSlices(ListToVec(t), ListToVec(a), depth+1)
+	case *Vec:
+		return compareSlices(t.V, a.(*Vec).V, depth+1)
+	case *PVec:
+		return compareSlices(t.ToSlice(), a.(*PVec).ToSlice(), depth+1)
+	case *Hash:
+		return compareEntries(hashEntries(t), hashEntries(a.(*Hash)), depth+1)
+	case *PMap:
+		return compareEntries(pmapEntries(t), pmapEntries(a.(*PMap)), depth+1)
+	case *Record:
+		b := a.(*Record)
+		if t.Type != b.Type {
+			if c := strings.Compare(t.Type.Name, b.Type.Name); c != 0 {
+				return c
+			}
+			return strings.Compare(fmt.Sprintf("%p", t.Type), fmt.Sprintf("%p", b.Type))
+		}
+		return compareSlices(t.Vals, b.Vals, depth+1)
+	}
+	if Equal(o, a) {
+		return 0
+	}
+	// Unordered types: fall back on type name and identity.
+	if c := strings.Compare(fmt.Sprintf("%T", o), fmt.Sprintf("%T", a)); c != 0 {
+		return c
+	}
+	return strings.Compare(fmt.Sprintf("%p", o), fmt.Sprintf("%p", a))
+}
+
+func cmpInts(a, b int) int {
+	switch {
+	case a < b:
+		return -1
+	case a > b:
+		return 1
+	}
+	return 0
+}
+
+func cmpBools(a, b bool) int {
+	switch {
+	case a == b:
+		return 0
+	case b:
+		return -1
+	}
+	return 1
+}
+
+func compareSlices(a, b []Any, depth int) int {
+	for i := 0; i < len(a) && i < len(b); i++ {
+		if c := compare(a[i], b[i], depth); c != 0 {
+			return c
+		}
+	}
+	return cmpInts(len(a), len(b))
+}
+
+func hashEntries(h *Hash) []Any {
+	var kvs []Any
+	for _, k := range h.Keys {
+		kvs = append(kvs, k, h.M[k])
+	}
+	return kvs
+}
+
+func pmapEntries(m *PMap) []Any {
+	var kvs []Any
+	m.Each(func(k, v Any) { kvs = append(kvs, k, v) })
+	return kvs
+}
+
+// compareEntries compares maps given as alternating keys and values,
+// by their entries sorted by key, so that insertion order does not matter.
+func compareEntries(a, b []Any, depth int) int {
+	return compareSlices(sortEntries(a, depth), sortEntries(b, depth), depth)
+}
+
+func sortEntries(kvs []Any, depth int) []Any {
+	pairs := make([][2]Any, len(kvs)/2)
+	for i := range pairs {
+		pairs[i] = [2]Any{kvs[2*i], kvs[2*i+1]}
+	}
+	sort.Slice(pairs, func(i, j int) bool { return compare(pairs[i][0], pairs[j][0], depth) < 0 })
+	z := make([]Any, 0, len(kvs))
+	for _, p := range pairs {
+		z = append(z, p[0], p[1])
+	}
+	return z
+}
+
+// HashCode is consistent with Equal: Equal values have the same HashCode.
+func HashCode(o Any) uint64 {
+	return hashCode(o, 0)
+}
+
+// hashCode is HashCode at depth within data.
+func hashCode(o Any, depth int) uint64 {
+	nested(depth)
+	h := fnv.New64a()
+	var b [8]byte
+	put := func(tag string, x uint64) {
+		h.Write([]byte(tag))
+		binary.LittleEndian.PutUint64(b[:], x)
+		h.Write(b[:])
+	}
+	putAll := func(tag string, xs []Any) {
+		put(tag, uint64(len(xs)))
+		for _, e := range xs {
+			put("", hashCode(e, depth+1))
+		}
+	}
+	// Map entries are summed, so the order does not matter.
+	putEntries := func(tag string, kvs []Any) {
+		sum := uint64(0)
+		for i := 0; i < len(kvs); i += 2 {
+			sum += hashCode(kvs[i], depth+1)*31 + hashCode(kvs[i+1], depth+1)
+		}
+		put(tag, sum)
+	}
+
+	if x, ok := IsNumber(o); ok {
+		switch {
+		case x != x:
+			x = math.NaN() // One canonical NaN.
+		case x == 0:
+			x = 0 // Fold -0 into 0.
+		}
+		put("n", math.Float64bits(x))
+		return h.Sum64()
+	}
+	switch t := o.(type) {
+	case Char:
+		put("c", uint64(t))
+	case string:
+		h.Write([]byte("s" + t))
+	case *Sym:
+		h.Write([]byte("y" + t.S))
+	case *Keyword:
+		h.Write([]byte("k" + t.S))
+	case *Pair:
+		putAll("l", ListToVec(t))
+	case *Vec:
+		putAll("v", t.V)
+	case *PVec:
+		putAll("p", t.ToSlice())
+	case *Hash:
+		putEntries("h", hashEntries(t))
+	case *PMap:
+		putEntries("m", pmapEntries(t))
+	case *Record:
+		h.Write([]byte("r" + t.Type.Name))
+		putAll("", t.Vals)
+	default:
+		h.Write([]byte(fmt.Sprintf("%T", o)))
+	}
+	return h.Sum64()
+}
+
+var BuiltinEqualityPrims = map[string]func([]Any, *Env) Any{
+	"equal?": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		return LispyBool(Equal(args[0], args[1]))
+	},
+	"compare": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		return float64(Compare(args[0], args[1]))
+	},
+	// (hash x) keeps 53 bits of the HashCode, so it is exact as a float.
+	"hash": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(HashCode(args[0]) >> 11)
+	},
+}
@@ -0,0 +1,50 @@
+package snoc
+
+import (
+	"math"
+	"testing"
+)
+
+func TestEqualCompareHash(t *testing.T) {
+	point := &StructType{Name: "point", Fields: []*Sym{Intern("x"), Intern("y")}}
+	values := func() []Any {
+		return []Any{
+			NIL,
+			1.0,
+			-0.0,
+			math.NaN(),
+			"one",
+			Intern("one"),
+			VecToList([]Any{1.0, "two", VecToList([]Any{Intern("three")})}),
+			&Vec{V: []Any{1.0, 2.0}},
+			NewHash([]Any{Intern("a"), 1.0, "b", &Vec{}}),
+			EmptyPMap.Assoc(VecToList([]Any{1.0}), "list key").Assoc(2.0, 3.0),
+			EmptyPVec.Conj(1.0).Conj(NIL),
+			&Record{Type: point, Vals: []Any{1.0, 2.0}},
+		}
+	}
+	xs, ys := values(), values() // Equal but not identical.
+	for i, x := range xs {
+		for j, y := range ys {
+			equal := Equal(x, y)
+			if equal != (i == j) {
+				t.Errorf("Equal(%v, %v) = %v", x, y, equal)
+			}
+			if c := Compare(x, y); (c == 0) != equal || c != -Compare(y, x) {
+				t.Errorf("Compare(%v, %v) = %d", x, y, c)
+			}
+			if equal && HashCode(x) != HashCode(y) {
+				t.Errorf("HashCode(%v) != HashCode(%v)", x, y)
+			}
+		}
+	}
+
+	if !Equal(1, 1.0) || HashCode(1) != HashCode(1.0) || !Equal(0.0, -0.0) || HashCode(0.0) != HashCode(-0.0) {
+		t.Errorf("numbers should be Equal by value")
+	}
+	h1 := NewHash([]Any{"a", 1.0, "b", 2.0})
+	h2 := NewHash([]Any{"b", 2.0, "a", 1.0})
+	if !Equal(h1, h2) || HashCode(h1) != HashCode(h2) || Compare(h1, h2) != 0 {
+		t.Errorf("insertion order should not matter")
+	}
+}
@@ -0,0 +1,264 @@
+// f.go: pretty printer
+
+package snoc
+
+import (
+	"strings"
+	"text/scanner"
+	"unicode/utf8"
+
+	. "github.com/strickyak/yak"
+)
+
+const DefaultWidth = 80
+
+// A Node is a piece of layout: either an atom with Text,
+// or a sequence of Kids between Open and Close brackets.
+// Nodes parsed from source (see ParseSource and ParseCST) also have
+// positions, may be comments, or may have Comments attached.
+type Node struct {
+	Text     string
+	Open     string
+	Close    string
+	Kids     []*Node
+	Comment  bool
+	Pos      scanner.Position // Where the node starts.
+	End      scanner.Position // Just after the node.
+	Comments []*Node          // Attached by ParseCST.
+}
+
+// PPStyle says how to indent a list whose head is a certain symbol.
+type PPStyle struct {
+	Header int  // How many args stay on the first line; the rest indent by 2.
+	Pairs  bool // Args go in pairs, like (if p1 x1 p2 x2 else) or (let a 1 b 2 body).
+}
+
+var PPStyles = map[string]PPStyle{
+	"defun":     {Header: 2},
+	"fn":        {Header: 1},
+	"def":       {Header: 1},
+	"defstruct": {Header: 1},
+	"module":    {Header: 1},
+	"if":        {Pairs: true},
+	"let":       {Pairs: true},
+}
+
+// ToNode converts data to a Node for layout.
+func ToNode(x Any) *Node {
+	return toNode(x, 0)
+}
+
+// toNode is ToNode at depth within data.
+func toNode(x Any, depth int) *Node {
+	nested(depth)
+	seq := func(open string, xs []Any, close string) *Node {
+		n := &Node{Open: open, Close: close}
+		for _, e := range xs {
+			n.Kids = append(n.Kids, toNode(e, depth+1))
+		}
+		return n
+	}
+	switch t := x.(type) {
+	case *Pair:
+		return seq("(", ListToVec(t), ")")
+	case *Vec:
+		return seq("[", t.V, "]")
+	case *PVec:
+		return seq("#pvec[", t.ToSlice(), "]")
+	case *Hash:
+		return seq("{", hashEntries(t), "}")
+	case *PMap:
+		return seq("#pmap{", pmapEntries(t), "}")
+	}
+	return &Node{Text: Write(x)}
+}
+
+// Flat is the Node all on one line.
+func (n *Node) Flat() string {
+	if n.Open == "" {
+		return n.Text
+	}
+	var buf strings.Builder
+	buf.WriteString(n.Open)
+	for i, k := range n.Kids {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(k.Flat())
+	}
+	buf.WriteString(n.Close)
+	return buf.String()
+}
+
+// PP lays out data readably within width columns.
+func PP(x Any, width int) string {
+	return PPNode(ToNode(x), 0, width)
+}
+
+// PPNode lays out a Node within width columns,
+// as if it started at column col.
+func PPNode(n *Node, col int, width int) string {
+	p := &printer{col: col, width: width}
+	p.node(n)
+	return p.buf.String()
+}
+
+type printer struct {
+	buf   strings.Builder
+	col   int
+	width int
+}
+
+func (p *printer) write(s string) {
+	p.buf.WriteString(s)
+	if i := strings.LastIndexByte(s, '\n'); i >= 0 {
+		p.col = utf8.RuneCountInString(s[i+1:])
+	} else {
+		p.col += utf8.RuneCountInString(s)
+	}
+}
+
+func (p *printer) newline(indent int) {
+	p.write("\n" + strings.Repeat(" ", indent))
+}
+
+func (p *printer) fits(n *Node) bool {
+	if n.HasComment() {
+		return false
+	}
+	flat := n.Flat()
+	return !strings.Contains(flat, "\n") && p.col+utf8.RuneCountInString(flat) <= p.width
+}
+
+// HasComment reports whether n is or contains a comment,
+// in which case it cannot be laid out flat.
+func (n *Node) HasComment() bool {
+	if n.Comment {
+		return true
+	}
+	for _, k := range n.Kids {
+		if k.HasComment() {
+			return true
+		}
+	}
+	return false
+}
+
+// sep goes before node k, which follows node prev.
+// A comment stays on the same line as what it followed;
+// anything else goes on a new line at indent.
+func (p *printer) sep(indent int, prev, k *Node) {
+	if k.Comment && prev != nil && k.Pos.Line == prev.End.Line {
+		p.write(" ")
+	} else {
+		p.newline(indent)
+	}
+}
+
+func (p *printer) node(n *Node) {
+	if n.Open == "" {
+		p.write(n.Text)
+		return
+	}
+	if p.fits(n) {
+		p.write(n.Flat())
+		return
+	}
+
+	start := p.col
+	p.write(n.Open)
+	kids := n.Kids
+	switch {
+	case len(kids) == 0:
+	case n.Open == "(" && kids[0].Open == "" && !kids[0].Comment:
+		p.list(start, kids)
+	case strings.HasSuffix(n.Open, "{"):
+		p.pairs(p.col, kids)
+	default:
+		p.column(p.col, kids)
+	}
+	if len(kids) > 0 && kids[len(kids)-1].Comment && IsLineComment(kids[len(kids)-1].Text) {
+		p.newline(start) // Do not close inside a line comment.
+	}
+	p.write(n.Close)
+}
+
+// list lays out the Kids of a list that starts with an atom.
+func (p *printer) list(start int, kids []*Node) {
+	head, args := kids[0], kids[1:]
+	p.write(head.Text)
+	style, ok := PPStyles[head.Text]
+	switch {
+	case len(args) == 0:
+	case ok && style.Pairs:
+		p.write(" ")
+		p.pairs(p.col, args)
+	case ok:
+		i := 0
+		for ; i < style.Header && i < len(args) && !args[i].Comment; i++ {
+			p.write(" ")
+			p.node(args[i])
+		}
+		prev := head
+		if i > 0 {
+			prev = args[i-1]
+		}
+		for _, a := range args[i:] {
+			p.sep(start+2, prev, a)
+			p.node(a)
+			prev = a
+		}
+	case p.col+1 > start+p.width/3:
+		// The head is long, so do not align args with the first one.
+		p.column(start+2, args)
+	default:
+		p.write(" ")
+		p.column(p.col, args)
+	}
+}
+
+// column puts each node on its own line, aligned at indent.
+func (p *printer) column(indent int, kids []*Node) {
+	for i, k := range kids {
+		if i > 0 {
+			p.sep(indent, kids[i-1], k)
+		}
+		p.node(k)
+	}
+}
+
+// pairs puts each pair of nodes on its own line, aligned at indent.
+// Comments do not count as members of pairs.
+func (p *printer) pairs(indent int, kids []*Node) {
+	second := false
+	for i, k := range kids {
+		switch {
+		case i == 0:
+		case k.Comment:
+			p.sep(indent, kids[i-1], k)
+		case second && !kids[i-1].Comment && !k.HasComment() && p.fits(&Node{Text: " " + k.Flat()}):
+			p.write(" ")
+		case second:
+			p.newline(indent + 2)
+		default:
+			p.newline(indent)
+		}
+		p.node(k)
+		if !k.Comment {
+			second = !second
+		}
+	}
+}
+
+var BuiltinPrettyPrims = map[string]func([]Any, *Env) Any{
+	// (pp x) or (pp x width) pretty-prints x to the output port.
+	"pp": func(args []Any, env *Env) Any {
+		Must(len(args) == 1 || len(args) == 2)
+		width := DefaultWidth
+		if len(args) == 2 {
+			width = int(ToFloat(args[1]))
+		}
+		output(env, PP(args[0], width)+"\n")
+		return NIL
+	},
+}
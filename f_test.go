@@ -0,0 +1,40 @@
+package snoc
+
+import (
+	"testing"
+)
+
+func TestPP(t *testing.T) {
+	scenarios := []struct {
+		source string
+		width  int
+		want   string
+	}{
+		{`(a b c)`, 80, `(a b c)`},
+		{`(defun my-sum (aList) (if (null? aList) 0 (+ (head aList) (my-sum (tail aList)))))`, 40,
+			`(defun my-sum (aList)
+  (if (null? aList) 0
+      (+ (head aList)
+         (my-sum (tail aList)))))`},
+		{`(let A (list 1 2 3) B (list 4 5 6) (list A B))`, 24,
+			`(let A (list 1 2 3)
+     B (list 4 5 6)
+     (list A B))`},
+		{`[alpha beta gamma {"key" [1 2 3] other-key "value"}]`, 30,
+			`[alpha
+ beta
+ gamma
+ {"key" [1 2 3]
+  other-key "value"}]`},
+	}
+	for _, sc := range scenarios {
+		x := ParseText(sc.source, "TestPP")[0]
+		got := PP(x, sc.width)
+		if got != sc.want {
+			t.Errorf("For %s at width %d, got\n%s\nwanted\n%s", sc.source, sc.width, got, sc.want)
+		}
+		if again := ParseText(got, "TestPP")[0]; !Equal(again, x) {
+			t.Errorf("PP output does not read back: %s", got)
+		}
+	}
+}
@@ -0,0 +1,545 @@
+// g.go: calling Go functions and methods by reflection
+
+package snoc
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+var errorType = reflect.TypeOf((*error)(nil)).Elem()
+
+// RegisterFunc defines name in core, and in every namespace that has
+// not defined it otherwise, as a prim that calls the Go function fn.
+// Arguments and results are converted by ToGo and FromGo.
+// A non-nil error as the last result becomes a Lisp error;
+// other results are returned as one value, or as a list if there are several.
+func (terp *Terp) RegisterFunc(name string, fn interface{}) {
+	v := reflect.ValueOf(fn)
+	if v.Kind() != reflect.Func {
+		Throw(Intern(name), "RegisterFunc needs a func for")
+	}
+	sym := Intern(name)
+	prim := &Prim{Name: name, F: func(args []Any, env *Env) Any {
+		return CallGo(name, v, args, env)
+	}}
+	core := terp.Modules["core"]
+	if !core.Exported(sym) {
+		core.Exports = append(core.Exports, sym)
+	}
+	// Namespaces still holding what they copied from core get the new prim.
+	old := core.Globals[sym]
+	inherited := func(m *Module) bool {
+		v, ok := m.Globals[sym]
+		return !ok || old != nil && reflect.TypeOf(old).Comparable() && v == old
+	}
+	spaces := append([]*Module{terp.NS}, terp.Loading...)
+	for _, m := range terp.Modules {
+		spaces = append(spaces, m)
+	}
+	for _, m := range spaces {
+		if m != nil && inherited(m) {
+			m.Globals[sym] = prim
+		}
+	}
+}
+
+// CallGo calls the Go function fn with converted args, and converts its results.
+func CallGo(name string, fn reflect.Value, args []Any, env *Env) Any {
+	t := fn.Type()
+	n := t.NumIn()
+	if t.IsVariadic() {
+		if len(args) < n-1 {
+			Throw(VecToList(args), "%s wants at least %d args, but got", name, n-1)
+		}
+	} else if len(args) != n {
+		Throw(VecToList(args), "%s wants %d args, but got", name, n)
+	}
+	in := make([]reflect.Value, len(args))
+	for i, a := range args {
+		var pt reflect.Type
+		if t.IsVariadic() && i >= n-1 {
+			pt = t.In(n - 1).Elem()
+		} else {
+			pt = t.In(i)
+		}
+		in[i] = ToGo(a, pt, env)
+	}
+	out := fn.Call(in)
+	if k := len(out); k > 0 && t.Out(k-1) == errorType {
+		if err, _ := out[k-1].Interface().(error); err != nil {
+			panic(&Error{Msg: fmt.Sprintf("%v, returned by %s", err, name), Err: err})
+		}
+		out = out[:k-1]
+	}
+	switch len(out) {
+	case 0:
+		return NIL
+	case 1:
+		return FromGo(out[0].Interface())
+	}
+	z := make([]Any, len(out))
+	for i, v := range out {
+		z[i] = FromGo(v.Interface())
+	}
+	return VecToList(z)
+}
+
+// FromGo converts a Go value to snoc.  Numbers become float64,
+// slices and arrays become lists, maps become Hashes, and structs
+// become Hashes with a keyword for each exported field (see fieldTag).
+// Snoc values, and Go values it cannot convert, are returned as they are.
+func FromGo(x interface{}) Any {
+	return fromGo(x, false, 0)
+}
+
+// fromGo is FromGo, but if data, as for Marshal, the result evaluates
+// to the value: it makes vectors instead of lists, since vectors evaluate
+// to themselves, quotes symbols and lists, follows pointers,
+// and fails on values that cannot be read back.  x is at depth within
+// the value converted.
+func fromGo(x interface{}, data bool, depth int) Any {
+	nested(depth)
+	switch t := x.(type) {
+	case nil:
+		return NIL
+	case *Pair, *Sym:
+		if data && t != NIL && t != TRUE {
+			readable(t, 0)
+			return Snoc(Snoc(NIL, t), QUOTE)
+		}
+		return t
+	case *Vec:
+		if data {
+			z := make([]Any, len(t.V))
+			for i, e := range t.V {
+				z[i] = fromGo(e, data, depth+1)
+			}
+			return &Vec{V: z}
+		}
+		return t
+	case *Hash:
+		if data {
+			h := NewHash(nil)
+			for _, k := range t.Keys {
+				h.Set(fromGo(k, data, depth+1), fromGo(t.M[k], data, depth+1))
+			}
+			return h
+		}
+		return t
+	case *PVec:
+		if data {
+			xs := t.ToSlice()
+			for i, e := range xs {
+				xs[i] = fromGo(e, data, depth+1)
+			}
+			return pvecConj(EmptyPVec, xs)
+		}
+		return t
+	case *PMap:
+		if data {
+			var kvs []Any
+			t.Each(func(k, v Any) {
+				kvs = append(kvs, fromGo(k, data, depth+1), fromGo(v, data, depth+1))
+			})
+			return pmapAssoc(EmptyPMap, kvs)
+		}
+		return t
+	case *Record:
+		if data {
+			readable(t, 0)
+		}
+		return t
+	case *Keyword, Char, string, float64:
+		return t
+	case bool:
+		return LispyBool(t)
+	case *Func, *ProtoFunc, *Prim, *Special:
+		if data {
+			Throw(t, "cannot convert to snoc data:")
+		}
+		return t
+	}
+	v := reflect.ValueOf(x)
+	switch v.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return float64(v.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return float64(v.Uint())
+	case reflect.Float32, reflect.Float64:
+		return v.Float()
+	case reflect.String:
+		return v.String()
+	case reflect.Bool:
+		return LispyBool(v.Bool())
+	case reflect.Slice, reflect.Array:
+		if v.Kind() == reflect.Slice && v.IsNil() {
+			return NIL
+		}
+		z := make([]Any, v.Len())
+		for i := range z {
+			z[i] = fromGo(v.Index(i).Interface(), data, depth+1)
+		}
+		if data {
+			return &Vec{V: z}
+		}
+		return VecToList(z)
+	case reflect.Map:
+		var kvs []Any
+		iter := v.MapRange()
+		for iter.Next() {
+			kvs = append(kvs, fromGo(iter.Key().Interface(), data, depth+1), fromGo(iter.Value().Interface(), data, depth+1))
+		}
+		return NewHash(sortEntries(kvs, 0))
+	case reflect.Struct:
+		h := NewHash(nil)
+		for _, f := range reflect.VisibleFields(v.Type()) {
+			name, omitEmpty := fieldTag(f)
+			if name == "" {
+				continue
+			}
+			fv, err := v.FieldByIndexErr(f.Index)
+			if err != nil || omitEmpty && fv.IsZero() {
+				continue
+			}
+			h.Set(InternKeyword(name), fromGo(fv.Interface(), data, depth+1))
+		}
+		return h
+	case reflect.Ptr, reflect.Interface, reflect.Func, reflect.Chan:
+		if v.IsNil() {
+			return NIL
+		}
+		if data && v.Kind() == reflect.Ptr {
+			return fromGo(v.Elem().Interface(), data, depth+1)
+		}
+	}
+	if data {
+		Throw(x, "cannot convert to snoc data:")
+	}
+	return x
+}
+
+// ToGo converts a snoc value to the Go type t, the inverse of FromGo.
+// A snoc func given for a Go func type is called with env,
+// and its errors are returned in an error result, if the func type has one.
+func ToGo(x Any, t reflect.Type, env *Env) reflect.Value {
+	if x != nil && x != NIL && reflect.TypeOf(x).AssignableTo(t) {
+		v := reflect.New(t).Elem()
+		v.Set(reflect.ValueOf(x))
+		return v
+	}
+	v := reflect.New(t).Elem()
+	switch t.Kind() {
+	case reflect.Interface:
+		if x == NIL {
+			return v // nil
+		}
+	case reflect.Bool:
+		v.SetBool(Bool(x))
+		return v
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		// Check the range as float64, since converting to int64 does not.
+		f, ok := IsNumber(x)
+		if ok && f == math.Trunc(f) && f >= -(1<<63) && f < 1<<63 && !v.OverflowInt(int64(f)) {
+			v.SetInt(int64(f))
+			return v
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		f, ok := IsNumber(x)
+		if ok && f == math.Trunc(f) && f >= 0 && f < 1<<64 && !v.OverflowUint(uint64(f)) {
+			v.SetUint(uint64(f))
+			return v
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := IsNumber(x); ok {
+			v.SetFloat(f)
+			return v
+		}
+	case reflect.String:
+		if s, ok := x.(string); ok {
+			v.SetString(s)
+			return v
+		}
+	case reflect.Slice, reflect.Array:
+		if elems, ok := sequence(x); ok {
+			if t.Kind() == reflect.Slice {
+				if x == NIL {
+					return v // nil
+				}
+				v = reflect.MakeSlice(t, len(elems), len(elems))
+			} else if len(elems) != t.Len() {
+				break
+			}
+			for i, e := range elems {
+				v.Index(i).Set(ToGo(e, t.Elem(), env))
+			}
+			return v
+		}
+	case reflect.Map:
+		if kvs, ok := entries(x); ok {
+			if x == NIL {
+				return v // nil
+			}
+			v = reflect.MakeMapWithSize(t, len(kvs)/2)
+			for i := 0; i < len(kvs); i += 2 {
+				v.SetMapIndex(ToGo(kvs[i], t.Key(), env), ToGo(kvs[i+1], t.Elem(), env))
+			}
+			return v
+		}
+	case reflect.Struct:
+		if kvs, ok := entries(x); ok {
+			for i := 0; i < len(kvs); i += 2 {
+				f, ok := fieldFor(t, kvs[i])
+				if !ok {
+					Throw(kvs[i], "%v has no field", t)
+				}
+				v.FieldByIndex(f.Index).Set(ToGo(kvs[i+1], f.Type, env))
+			}
+			return v
+		}
+	case reflect.Ptr:
+		if x == NIL {
+			return v // nil
+		}
+		p := reflect.New(t.Elem())
+		p.Elem().Set(ToGo(x, t.Elem(), env))
+		return p
+	case reflect.Func:
+		if x == NIL {
+			return v // nil
+		}
+		if env == nil || env.Terp == nil {
+			Throw(x, "cannot convert to Go %v without a Terp:", t)
+		}
+		terp := env.Terp
+		return reflect.MakeFunc(t, func(in []reflect.Value) []reflect.Value {
+			var out []reflect.Value
+			_, err := terp.run(terp.ctx, func() Any {
+				args := make([]Any, len(in))
+				for i, a := range in {
+					args[i] = FromGo(a.Interface())
+				}
+				out = results(ApplyValues(x, args, env), t, env)
+				return nil
+			})
+			if err == nil {
+				return out
+			}
+			return failed(terp, err, t)
+		})
+	}
+	Throw(x, "cannot convert to Go %v:", t)
+	return v
+}
+
+// failed returns a Lisp error from a snoc func called from Go
+// in the error result of the Go func type t, if it has one.
+// Otherwise, if it was called back during EvalString or Call, the error
+// goes on to that; if it was called later, the error is only logged.
+func failed(terp *Terp, err error, t reflect.Type) []reflect.Value {
+	out := make([]reflect.Value, t.NumOut())
+	for i := range out {
+		out[i] = reflect.Zero(t.Out(i))
+	}
+	if n := len(out); n > 0 && t.Out(n-1) == errorType {
+		out[n-1] = reflect.ValueOf(&err).Elem()
+		return out
+	}
+	if terp.runs > 0 {
+		panic(err)
+	}
+	log.Printf("ERROR in snoc func called from Go as %v: %v", t, err)
+	return out
+}
+
+// results converts the value of a snoc func called from Go
+// to the results of the Go func type t.
+func results(x Any, t reflect.Type, env *Env) []reflect.Value {
+	n := t.NumOut()
+	if n > 0 && t.Out(n-1) == errorType {
+		n-- // Lisp errors go there by failed instead.
+	}
+	var xs []Any
+	switch n {
+	case 0:
+	case 1:
+		xs = []Any{x}
+	default:
+		xs = ListToVec(x)
+		if len(xs) != n {
+			Throw(x, "wanted %d results for Go %v, but got", n, t)
+		}
+	}
+	out := make([]reflect.Value, t.NumOut())
+	for i := range out {
+		if i < len(xs) {
+			out[i] = ToGo(xs[i], t.Out(i), env)
+		} else {
+			out[i] = reflect.Zero(t.Out(i))
+		}
+	}
+	return out
+}
+
+// sequence returns the elements of a list or vector.
+func sequence(x Any) ([]Any, bool) {
+	switch t := x.(type) {
+	case *Pair:
+		return ListToVec(t), true
+	case *Vec:
+		return t.V, true
+	case *PVec:
+		return t.ToSlice(), true
+	}
+	return nil, false
+}
+
+// entries returns the keys and values of a map or property list.
+func entries(x Any) ([]Any, bool) {
+	switch t := x.(type) {
+	case *Pair:
+		kvs := ListToVec(t)
+		if len(kvs)%2 != 0 {
+			Throw(x, "property list needs an even number of keys and values:")
+		}
+		return kvs, true
+	case *Hash:
+		return hashEntries(t), true
+	case *PMap:
+		return sortEntries(pmapEntries(t), 0), true
+	}
+	return nil, false
+}
+
+// fieldTag is the snoc name of a struct field, from a tag like
+// `snoc:"name"` or else the field name, and whether the tag says
+// `snoc:",omitempty"`.  The name is empty for unexported and embedded
+// fields, and for a tag of `snoc:"-"`.
+func fieldTag(f reflect.StructField) (name string, omitEmpty bool) {
+	if !f.IsExported() || f.Anonymous {
+		return "", false
+	}
+	tag, opts, _ := strings.Cut(f.Tag.Get("snoc"), ",")
+	switch tag {
+	case "-":
+		return "", false
+	case "":
+		tag = f.Name
+	}
+	return tag, opts == "omitempty"
+}
+
+// fieldFor finds the field named by a keyword, symbol, or string,
+// ignoring case if there is no exact match.
+func fieldFor(t reflect.Type, key Any) (reflect.StructField, bool) {
+	var name string
+	switch k := key.(type) {
+	case *Keyword:
+		name = k.S
+	case *Sym:
+		name = k.S
+	case string:
+		name = k
+	default:
+		return reflect.StructField{}, false
+	}
+	fields := reflect.VisibleFields(t)
+	sort.SliceStable(fields, func(i, j int) bool { return len(fields[i].Index) < len(fields[j].Index) })
+	var fold []reflect.StructField
+	for _, f := range fields {
+		tag, _ := fieldTag(f)
+		if tag == "" {
+			continue
+		}
+		if tag == name {
+			return f, true
+		}
+		if strings.EqualFold(tag, name) {
+			fold = append(fold, f)
+		}
+	}
+	if len(fold) > 0 {
+		return fold[0], true
+	}
+	return reflect.StructField{}, false
+}
+
+// memberName is the name of a method or field, from a symbol, keyword, or string.
+func memberName(x Any) string {
+	switch t := x.(type) {
+	case *Sym:
+		return t.S
+	case *Keyword:
+		return t.S
+	case string:
+		return t
+	}
+	Throw(x, "wanted a method or field name, but got")
+	return ""
+}
+
+// methodFor finds the method of v with the name,
+// ignoring case if there is no exact match.
+func methodFor(v reflect.Value, name string) (reflect.Value, bool) {
+	if m := v.MethodByName(name); m.IsValid() {
+		return m, true
+	}
+	for i := 0; i < v.NumMethod(); i++ {
+		if strings.EqualFold(v.Type().Method(i).Name, name) {
+			return v.Method(i), true
+		}
+	}
+	return reflect.Value{}, false
+}
+
+var BuiltinGoSpecials = map[string]func([]Any, *Env) Any{
+	// (. obj Method args...) calls a method of a Go value,
+	// converting like a func from RegisterFunc.
+	".": func(args []Any, env *Env) Any {
+		if len(args) < 2 {
+			Throw(VecToList(args), "(. obj Method args...) got")
+		}
+		obj := Eval(args[0], env)
+		name := memberName(args[1])
+		m, ok := methodFor(reflect.ValueOf(obj), name)
+		if !ok {
+			Throw(obj, "no method %s for", name)
+		}
+		vals := make([]Any, len(args)-2)
+		for i, a := range args[2:] {
+			vals[i] = Eval(a, env)
+		}
+		return CallGo(name, m, vals, env)
+	},
+	// (.- obj Field) gets a field of a Go struct, or pointer to one.
+	// (.- obj Field value) sets it, if obj is a pointer.
+	".-": func(args []Any, env *Env) Any {
+		if len(args) != 2 && len(args) != 3 {
+			Throw(VecToList(args), "(.- obj Field) or (.- obj Field value) got")
+		}
+		obj := Eval(args[0], env)
+		v := reflect.ValueOf(obj)
+		for v.Kind() == reflect.Ptr && !v.IsNil() {
+			v = v.Elem()
+		}
+		if v.Kind() != reflect.Struct {
+			Throw(obj, "cannot get fields of")
+		}
+		f, ok := fieldFor(v.Type(), memberName(args[1]))
+		if !ok {
+			Throw(obj, "no field %s in", memberName(args[1]))
+		}
+		if len(args) == 2 {
+			return FromGo(v.FieldByIndex(f.Index).Interface())
+		}
+		if !v.CanSet() {
+			Throw(obj, "cannot set field %s of", f.Name)
+		}
+		v.FieldByIndex(f.Index).Set(ToGo(Eval(args[2], env), f.Type, env))
+		return NIL
+	},
+}
@@ -0,0 +1,247 @@
+package snoc
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+type gPoint struct {
+	X, Y int
+	Name string
+}
+
+func TestRegisterFunc(t *testing.T) {
+	terp := NewTerp()
+	terp.RegisterFunc("go-add", func(a, b int) int { return a + b })
+	terp.RegisterFunc("go-join", strings.Join)
+	terp.RegisterFunc("go-div", func(a, b float64) (float64, error) {
+		if b == 0 {
+			return 0, errors.New("division by zero")
+		}
+		return a / b, nil
+	})
+	terp.RegisterFunc("go-sum", func(xs ...float64) (z float64) {
+		for _, x := range xs {
+			z += x
+		}
+		return
+	})
+	terp.RegisterFunc("go-counts", func(words []string) map[string]int {
+		m := make(map[string]int)
+		for _, w := range words {
+			m[w]++
+		}
+		return m
+	})
+	terp.RegisterFunc("go-move", func(p gPoint, dx int) gPoint {
+		p.X += dx
+		return p
+	})
+	terp.RegisterFunc("go-map", func(f func(int) int, xs []int) []int {
+		for i, x := range xs {
+			xs[i] = f(x)
+		}
+		return xs
+	})
+	terp.RegisterFunc("go-int64", func(n int64) int64 { return n })
+	terp.RegisterFunc("go-int", func(n int) int { return n })
+	terp.RegisterFunc("go-uint", func(n uint) uint { return n })
+	terp.RegisterFunc("go-uint8", func(n uint8) uint8 { return n })
+	terp.RegisterFunc("go-split", func(s string) (string, string) {
+		a, b, _ := strings.Cut(s, "=")
+		return a, b
+	})
+
+	other := NewTerp()
+	if _, ok := other.Globals[Intern("go-add")]; ok {
+		t.Errorf("RegisterFunc leaked into another Terp")
+	}
+
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(go-add 3 4)`, "7"},
+		{`(go-join (list "a" "b") "-")`, "a-b"},
+		{`(go-div 1 4)`, "0.25"},
+		{`(go-div 1 0)`, "*ERROR* *repl*:1:1: division by zero, returned by go-div"},
+		{`(list (go-sum) (go-sum 1 2 3))`, "(0 6)"},
+		{`(go-counts ["b" "a" "b"])`, `{a 1 b 2}`},
+		{`(go-move {:X 1 :y 2 :Name "p"} 10)`, "{:X 11 :Y 2 :Name p}"},
+		{`(go-move (list :X 1) 0.5)`, "*ERROR* *repl*:1:1: cannot convert to Go int: 0.5"},
+		{`(go-move {:Z 1} 0)`, "*ERROR* *repl*:1:1: snoc.gPoint has no field :Z"},
+		{`(defun demo () (go-map (fn (x) (* x 10)) (list 1 2)))
+		  (demo)`, "(10 20)"},
+		{`(go-split "k=v")`, "(k v)"},
+		{`(go-add 1)`, "*ERROR* *repl*:1:1: go-add wants 2 args, but got (1)"},
+		{`(list (go-int64 -9007199254740992) (go-uint 4e18) (go-uint8 255))`, "(-9.007199254740992e+15 4e+18 255)"},
+		{`(go-int64 1e300)`, "*ERROR* *repl*:1:1: cannot convert to Go int64: 1e+300"},
+		{`(go-int64 -1e19)`, "*ERROR* *repl*:1:1: cannot convert to Go int64: -1e+19"},
+		{`(go-int64 9223372036854775808)`, "*ERROR* *repl*:1:1: cannot convert to Go int64: 9.223372036854776e+18"},
+		{`(go-int 1e19)`, "*ERROR* *repl*:1:1: cannot convert to Go int: 1e+19"},
+		{`(go-int64 (div 1 0))`, "*ERROR* *repl*:1:1: cannot convert to Go int64: +Inf"},
+		{`(go-int64 NaN)`, "*ERROR* *repl*:1:1: cannot convert to Go int64: NaN"},
+		{`(go-uint 1e30)`, "*ERROR* *repl*:1:1: cannot convert to Go uint: 1e+30"},
+		{`(go-uint 18446744073709551616)`, "*ERROR* *repl*:1:1: cannot convert to Go uint: 1.8446744073709552e+19"},
+		{`(go-uint -1)`, "*ERROR* *repl*:1:1: cannot convert to Go uint: -1"},
+		{`(go-uint8 256)`, "*ERROR* *repl*:1:1: cannot convert to Go uint8: 256"},
+	}
+	for _, sc := range scenarios {
+		results := Repl(terp, strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
+
+type gAccount struct {
+	Owner   string
+	Balance float64
+	History []float64
+}
+
+func (a *gAccount) Deposit(x float64) float64 {
+	a.Balance += x
+	a.History = append(a.History, x)
+	return a.Balance
+}
+
+func (a gAccount) Describe(prefix string) string {
+	return prefix + a.Owner
+}
+
+func TestGoMethods(t *testing.T) {
+	terp := NewTerp()
+	terp.RegisterFunc("new-account", func(owner string) *gAccount { return &gAccount{Owner: owner} })
+	terp.RegisterFunc("account-value", func(owner string) gAccount { return gAccount{Owner: owner} })
+
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(def acct (new-account "ann"))
+		  (defun demo () (let
+		       a (new-account "ann")
+		       b (. a Deposit 10)
+		       c (. a deposit 5)
+		       (list b c (.- a Balance) (.- a history) (. a Describe "owner: "))))
+		  (demo)`, "(10 15 15 (10 5) owner: ann)"},
+		{`(defun demo () (let
+		       a (new-account "bob")
+		       b (.- a Owner "rob")
+		       (.- a Owner)))
+		  (demo)`, "rob"},
+		{`(account-value "cy")`, `{:Owner cy :Balance 0 :History ()}`},
+		{`(defun demo () (. (new-account "dee") Withdraw 1))
+		  (demo)`, "*ERROR* *repl*:1:16: in demo: no method Withdraw for #<go *snoc.gAccount>"},
+		{`(defun demo () (.- (new-account "eve") Age))
+		  (demo)`, "*ERROR* *repl*:1:16: in demo: no field Age in #<go *snoc.gAccount>"},
+		{`(defun demo () (. (new-account "fay") Deposit "lots"))
+		  (demo)`, "*ERROR* *repl*:1:16: in demo: cannot convert to Go float64: \"lots\""},
+	}
+	for _, sc := range scenarios {
+		results := Repl(terp, strings.NewReader(sc.program))
+		got := Stringify(results[len(results)-1])
+		if got = strings.SplitN(got, "\n", 2)[0]; got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
+
+func TestGoCallbacks(t *testing.T) {
+	ctx := context.Background()
+	terp := NewTerp()
+	var kept func(int) int
+	var keptErr func() error
+	terp.RegisterFunc("go-try", func(f func(int) (int, error)) string {
+		if z, err := f(1); err != nil {
+			return "failed: " + strings.SplitN(err.Error(), "\n", 2)[0]
+		} else {
+			return fmt.Sprint("got ", z)
+		}
+	})
+	terp.RegisterFunc("go-apply", func(f func(int) int) int { return f(1) })
+	terp.RegisterFunc("go-keep", func(f func(int) int, g func() error) { kept, keptErr = f, g })
+	if _, err := terp.EvalString(ctx, `
+		(defun good (x) (+ x 1))
+		(defun bad (x) (head x))
+		(defun try-good () (go-try (fn (x) (good x))))
+		(defun try-bad () (go-try (fn (x) (bad x))))
+		(defun apply-bad () (go-apply (fn (x) (bad x))))
+		(defun keep () (go-keep (fn (x) (bad x)) (fn () (bad 2))))
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(try-good)`, "got 2"},
+		{`(try-bad)`, "failed: *eval*:3:18: in bad: cannot Head 1"},
+		{`(list (try-bad) (try-good))`, "(failed: *eval*:3:18: in bad: cannot Head 1 got 2)"},
+		{`(apply-bad)`, "*eval*:3:18: in bad: cannot Head 1"},
+	}
+	for _, sc := range scenarios {
+		z, err := terp.EvalString(ctx, sc.program)
+		got := Stringify(z)
+		if err != nil {
+			got = strings.SplitN(err.Error(), "\n", 2)[0]
+		}
+		if got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+		if len(terp.Stack) != 0 || terp.Used.Depth != 0 {
+			t.Errorf("After %s, stack %v and depth %d", sc.program, terp.Stack, terp.Used.Depth)
+		}
+	}
+
+	// Callbacks that Go calls later, outside EvalString, do not panic.
+	if _, err := terp.EvalString(ctx, `(keep)`); err != nil {
+		t.Fatal(err)
+	}
+	if z := kept(1); z != 0 {
+		t.Errorf("Got %d, wanted 0", z)
+	}
+	if err := keptErr(); err == nil || !strings.Contains(err.Error(), "cannot Head 2") {
+		t.Errorf("Got %v, wanted cannot Head 2", err)
+	}
+}
+
+func TestRegisterFuncNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"early.snoc": `(module early (export call-it)) (defun call-it () (go-late))`,
+		"own.snoc":   `(module own (export call-it)) (defun go-late () "own") (defun call-it () (go-late))`,
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	terp := NewTerp()
+	terp.Path = []string{dir}
+	ctx := context.Background()
+	if _, err := terp.EvalString(ctx, `(import early) (import own)`); err != nil {
+		t.Fatal(err)
+	}
+	terp.RegisterFunc("go-late", func() string { return "go" })
+	z, err := terp.EvalString(ctx, `(list (go-late) (early/call-it) (own/call-it))`)
+	if got := Stringify(z); err != nil || got != "(go go own)" {
+		t.Errorf("Got %s, %v, wanted (go go own)", got, err)
+	}
+
+	// A definition of the current namespace is kept too.
+	if _, err := terp.EvalString(ctx, `(defun go-mine () "mine")`); err != nil {
+		t.Fatal(err)
+	}
+	terp.RegisterFunc("go-mine", func() string { return "go" })
+	if z, err := terp.EvalString(ctx, `(go-mine)`); err != nil || z != "mine" {
+		t.Errorf("Got %v, %v, wanted mine", z, err)
+	}
+}
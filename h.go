@@ -0,0 +1,141 @@
+// h.go: hash tables
+
+package snoc
+
+import (
+	. "github.com/strickyak/yak"
+)
+
+// NewHash makes a Hash from alternating keys and values.
+// The keys must pass CheckKey.
+func NewHash(kvs []Any) *Hash {
+	for i := 0; i < len(kvs); i += 2 {
+		CheckKey(kvs[i])
+	}
+	return newForms(kvs)
+}
+
+// newForms is NewHash without checking the keys, for a {k v} literal read
+// as source, whose keys are forms that are checked when evaluated.
+func newForms(kvs []Any) *Hash {
+	if len(kvs)%2 != 0 {
+		Throw(VecToList(kvs), "Hash needs an even number of keys and values")
+	}
+	h := &Hash{M: make(map[Any]Any)}
+	for i := 0; i < len(kvs); i += 2 {
+		h.Set(kvs[i], kvs[i+1])
+	}
+	return h
+}
+
+func ToHash(o Any) *Hash {
+	switch t := o.(type) {
+	case *Hash:
+		return t
+	}
+	Throw(o, "cannot Hash")
+	return nil
+}
+
+// CheckKey allows only keys whose Go equality agrees with Eq.
+// NaN is not equal to itself, so it is not allowed either.
+func CheckKey(k Any) Any {
+	switch t := k.(type) {
+	case float64:
+		if t == t {
+			return k
+		}
+	case *Sym, *Keyword, string, int, Char:
+		return k
+	}
+	return Throw(k, "cannot use as Hash key")
+}
+
+func (o *Hash) Get(k Any) (Any, bool) {
+	v, ok := o.M[k]
+	return v, ok
+}
+
+func (o *Hash) Set(k Any, v Any) {
+	if _, ok := o.M[k]; !ok {
+		o.Keys = append(o.Keys, k)
+	}
+	o.M[k] = v
+}
+
+func (o *Hash) Remove(k Any) {
+	if _, ok := o.M[k]; !ok {
+		return
+	}
+	delete(o.M, k)
+	for i, e := range o.Keys {
+		if e == k {
+			o.Keys = append(o.Keys[:i:i], o.Keys[i+1:]...)
+			break
+		}
+	}
+}
+
+var BuiltinHashPrims = map[string]func([]Any, *Env) Any{
+	"make-hash": func(args []Any, env *Env) Any {
+		return NewHash(args)
+	},
+	"hash?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(*Hash)
+		return LispyBool(ok)
+	},
+	"hash-count": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(len(ToHash(args[0]).Keys))
+	},
+	// (hash-ref h k) throws if k is missing; (hash-ref h k default) does not.
+	"hash-ref": func(args []Any, env *Env) Any {
+		Must(len(args) == 2 || len(args) == 3)
+		v, ok := ToHash(args[0]).Get(CheckKey(args[1]))
+		if !ok {
+			if len(args) == 3 {
+				return args[2]
+			}
+			Throw(args[1], "hash-ref: key not found")
+		}
+		return v
+	},
+	"hash-set!": func(args []Any, env *Env) Any {
+		MustLen(args, 3)
+		ToHash(args[0]).Set(CheckKey(args[1]), args[2])
+		return args[2]
+	},
+	"hash-remove!": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		ToHash(args[0]).Remove(CheckKey(args[1]))
+		return NIL
+	},
+	"hash-keys": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		h := ToHash(args[0])
+		Alloc(env, len(h.Keys))
+		return VecToList(h.Keys)
+	},
+	"hash-values": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		h := ToHash(args[0])
+		Alloc(env, len(h.Keys))
+		z := make([]Any, len(h.Keys))
+		for i, k := range h.Keys {
+			z[i] = h.M[k]
+		}
+		return VecToList(z)
+	},
+	// (hash-for-each h f) calls (f k v) for each entry, in insertion order.
+	"hash-for-each": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		h := ToHash(args[0])
+		for _, k := range append([]Any(nil), h.Keys...) {
+			if v, ok := h.M[k]; ok {
+				ApplyValues(args[1], []Any{k, v}, env)
+			}
+		}
+		return NIL
+	},
+}
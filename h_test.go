@@ -0,0 +1,31 @@
+package snoc
+
+import (
+	"strings"
+	"testing"
+)
+
+// TestHashKeys checks that literals and make-hash accept the same keys.
+func TestHashKeys(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(hash-ref {(+ 1 2) "three" (quote a) "a" :k "k"} 3)`, "three"},
+		{`(hash-count {1 "one" 1 "uno"})`, "1"},
+		{`(hash-ref {"s" 1 #\c 2} #\c)`, "2"},
+		{`{(list 1) 2}`, "*ERROR* cannot use as Hash key (1)"},
+		{`(make-hash (list 1) 2)`, "*ERROR* *repl*:1:1: cannot use as Hash key (1)"},
+		{`{[1] 2}`, "*ERROR* cannot use as Hash key [1]"},
+		{`{NaN 1}`, "*ERROR* cannot use as Hash key NaN"},
+		{`(make-hash NaN 1 NaN 2)`, "*ERROR* *repl*:1:1: cannot use as Hash key NaN"},
+		{`(hash-set! (make-hash) NaN 1)`, "*ERROR* *repl*:1:1: cannot use as Hash key NaN"},
+		{`(make-hash 1)`, "*ERROR* *repl*:1:1: Hash needs an even number of keys and values (1)"},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
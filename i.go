@@ -0,0 +1,543 @@
+// i.go: streaming reader
+
+package snoc
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+	"text/scanner"
+	"unicode"
+)
+
+// ErrIncomplete means the input ended inside a form.
+// With more input, it might have been fine.
+var ErrIncomplete = errors.New("incomplete form")
+
+// A SyntaxError is a mistake in the input at Pos.
+// Its Err may be ErrIncomplete; test with errors.Is.
+type SyntaxError struct {
+	Pos scanner.Position
+	Err error
+}
+
+func (e *SyntaxError) Error() string {
+	return fmt.Sprintf("%v: %v", e.Pos, e.Err)
+}
+
+func (e *SyntaxError) Unwrap() error {
+	return e.Err
+}
+
+// A Reader reads forms one at a time from an io.Reader.
+// It buffers the input, so it may read ahead of the last form returned,
+// but it does not wait for more input once a form is complete.
+type Reader struct {
+	Where map[*Pair]scanner.Position // If not nil, record where lists start.
+
+	// GoComments says whether to accept Go-style // and /* */ comments,
+	// besides the Lisp-style ; line comments, #| |# block comments,
+	// and #; datum comments, which comment out the next form.
+	// NewReader sets it.
+	GoComments bool
+
+	r     *bufio.Reader
+	pos   scanner.Position // Of the next rune.
+	at    scanner.Position // Of the last closing bracket.
+	size  int              // Of the last rune, for unread.
+	col   int              // Column before the last newline, for unread.
+	err   error            // From r, other than io.EOF.
+	open  int              // Brackets open, which a mistake leaves unclosed.
+	depth int              // Forms being read, one inside another.
+	src   string           // The whole input, for ParseSource.
+
+	placed []placement // Lists of the form being read, added to Where if it is fine.
+}
+
+type placement struct {
+	p   *Pair
+	pos scanner.Position
+}
+
+const eof = -1
+
+// readFailure is panicked inside the Reader, and recovered by Read.
+type readFailure struct {
+	err error
+}
+
+func NewReader(r io.Reader, filename string) *Reader {
+	return &Reader{
+		r:          bufio.NewReader(r),
+		pos:        scanner.Position{Filename: filename, Line: 1, Column: 1},
+		GoComments: true,
+	}
+}
+
+// Read reads the next form.  At the end of the input, it returns io.EOF.
+// If the input ends inside a form, the error Is ErrIncomplete.
+// Other mistakes are a *SyntaxError; Read may be called again after them,
+// and continues after the end of the broken form.
+func (rd *Reader) Read() (x Any, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(readFailure)
+			if !ok {
+				panic(r)
+			}
+			x, err = nil, f.err
+			rd.depth = 0
+			rd.skipOpen()
+		}
+		rd.placed = rd.placed[:0]
+	}()
+	x, close := rd.datum()
+	switch close {
+	case 0:
+		for _, e := range rd.placed {
+			rd.Where[e.p] = e.pos
+		}
+		return x, nil
+	case eof:
+		if rd.err != nil {
+			return nil, rd.err
+		}
+		return nil, io.EOF
+	}
+	rd.fail(rd.at, "unexpected %q", close)
+	return nil, nil
+}
+
+// skipOpen skips the rest of the forms left open by a mistake,
+// so nothing inside them is read as a top-level form.
+// It goes token by token, so it does not recurse however deep they are.
+func (rd *Reader) skipOpen() {
+	for rd.open > 0 {
+		if rd.skipToken() == eof {
+			break
+		}
+	}
+	rd.open = 0
+}
+
+// skipToken reads and drops one token, ignoring mistakes,
+// and counts the brackets it opens and closes.
+func (rd *Reader) skipToken() (close rune) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(readFailure); !ok {
+				panic(r)
+			}
+			if rd.peek() == eof {
+				close = eof
+			}
+		}
+	}()
+	switch kind, _, _ := rd.token(); kind {
+	case tokOpen:
+		rd.open++
+	case tokClose:
+		rd.open--
+	case tokEOF:
+		return eof
+	}
+	return 0
+}
+
+// readNode is Read for ParseSource.
+func (rd *Reader) readNode() (n *Node, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(readFailure)
+			if !ok {
+				panic(r)
+			}
+			n, err = nil, f.err
+			rd.depth = 0
+		}
+	}()
+	n, close := rd.node()
+	switch close {
+	case 0:
+		return n, nil
+	case eof:
+		return nil, io.EOF
+	}
+	rd.fail(rd.at, "unexpected %q", close)
+	return nil, nil
+}
+
+func (rd *Reader) fail(pos scanner.Position, format string, args ...interface{}) {
+	panic(readFailure{&SyntaxError{Pos: pos, Err: fmt.Errorf(format, args...)}})
+}
+
+func (rd *Reader) incomplete(pos scanner.Position) {
+	panic(readFailure{&SyntaxError{Pos: pos, Err: ErrIncomplete}})
+}
+
+// nest counts a form started at pos, until the caller decrements depth.
+// Like data printed or compared, forms nest only MaxNesting deep,
+// so reading them cannot overflow the Go stack.
+func (rd *Reader) nest(pos scanner.Position) {
+	rd.depth++
+	defer func() {
+		if r := recover(); r != nil {
+			e, ok := r.(*Error)
+			if !ok {
+				panic(r)
+			}
+			panic(readFailure{&SyntaxError{Pos: pos, Err: e.Err}})
+		}
+	}()
+	nested(rd.depth - 1)
+}
+
+func (rd *Reader) next() rune {
+	if rd.err != nil {
+		return eof
+	}
+	r, size, err := rd.r.ReadRune()
+	if err != nil {
+		if err != io.EOF {
+			rd.err = err
+		}
+		return eof
+	}
+	rd.size = size
+	rd.pos.Offset += size
+	if r == '\n' {
+		rd.col = rd.pos.Column
+		rd.pos.Line++
+		rd.pos.Column = 1
+	} else {
+		rd.pos.Column++
+	}
+	return r
+}
+
+func (rd *Reader) unread(r rune) {
+	if r == eof {
+		return
+	}
+	rd.r.UnreadRune()
+	rd.pos.Offset -= rd.size
+	if r == '\n' {
+		rd.pos.Line--
+		rd.pos.Column = rd.col
+	} else {
+		rd.pos.Column--
+	}
+}
+
+func (rd *Reader) peek() rune {
+	r := rd.next()
+	rd.unread(r)
+	return r
+}
+
+// isDelimiter tells if r ends a symbol or number.
+func isDelimiter(r rune) bool {
+	switch r {
+	case '(', ')', '[', ']', '{', '}', ';', eof:
+		return true
+	}
+	return r <= ' '
+}
+
+// Kinds of tokens.
+const (
+	tokAtom    = iota
+	tokOpen    // "(", "[", "{", "#pmap{", or "#pvec[".
+	tokClose   // ")", "]", or "}".
+	tokComment // Including its delimiters.
+	tokSkip    // "#;", which comments out the next form.
+	tokEOF
+)
+
+// closer is the closing bracket for an opening one.
+func closer(open string) rune {
+	switch open[len(open)-1] {
+	case '(':
+		return ')'
+	case '[':
+		return ']'
+	}
+	return '}'
+}
+
+// token reads the next token, skipping spaces, and returns its original text.
+func (rd *Reader) token() (kind int, text string, pos scanner.Position) {
+	for {
+		pos = rd.pos
+		r := rd.next()
+		switch {
+		case r == eof:
+			return tokEOF, "", pos
+		case r <= ' ':
+			continue
+		case r == ')' || r == ']' || r == '}':
+			return tokClose, string(r), pos
+		case r == '(' || r == '[' || r == '{':
+			return tokOpen, string(r), pos
+		case r == ';':
+			return tokComment, ";" + rd.line(), pos
+		case r == '/' && rd.GoComments && rd.peek() == '/':
+			return tokComment, "/" + rd.line(), pos
+		case r == '/' && rd.GoComments && rd.peek() == '*':
+			rd.next()
+			return tokComment, "/*" + rd.block(pos, "*/", ""), pos
+		case r == '"' || r == '`' || r == '|':
+			return tokAtom, rd.str(pos, string(r)), pos
+		case r == ':' && rd.peek() == '|':
+			rd.next()
+			return tokAtom, ":" + rd.str(pos, "|"), pos
+		case r == '#':
+			switch rd.peek() {
+			case '|':
+				rd.next()
+				return tokComment, "#|" + rd.block(pos, "|#", "#|"), pos
+			case ';':
+				rd.next()
+				return tokSkip, "#;", pos
+			case '\\':
+				rd.next()
+				r := rd.next()
+				if r == eof {
+					rd.incomplete(pos)
+				}
+				text := `#\` + string(r)
+				for unicode.IsLetter(rd.peek()) || unicode.IsDigit(rd.peek()) {
+					text += string(rd.next())
+				}
+				return tokAtom, text, pos
+			}
+			word := rd.word("#")
+			switch word {
+			case "#pmap", "#pvec":
+				open := map[string]rune{"#pmap": '{', "#pvec": '['}[word]
+				if rd.next() != open {
+					rd.fail(pos, "expected %c after %s", open, word)
+				}
+				return tokOpen, word + string(open), pos
+			}
+			return tokAtom, word, pos
+		default:
+			return tokAtom, rd.word(string(r)), pos
+		}
+	}
+}
+
+// datum reads one form, skipping comments.
+// If it finds a closing bracket or the end of the input instead,
+// it returns that as close.
+func (rd *Reader) datum() (x Any, close rune) {
+	for {
+		kind, text, pos := rd.token()
+		switch kind {
+		case tokEOF:
+			return nil, eof
+		case tokClose:
+			rd.at = pos
+			return nil, rune(text[0])
+		case tokComment:
+			continue
+		case tokSkip:
+			rd.nest(pos)
+			if _, close := rd.datum(); close == eof {
+				rd.incomplete(pos)
+			} else if close != 0 {
+				rd.fail(pos, "nothing after #; before %q", close)
+			}
+			rd.depth--
+			continue
+		case tokAtom:
+			return rd.atom(pos, text), 0
+		}
+		switch text {
+		case "(":
+			list := VecToList(rd.seq(pos, ')'))
+			if p, ok := list.(*Pair); ok && rd.Where != nil && p != NIL {
+				rd.placed = append(rd.placed, placement{p, pos})
+			}
+			return list, 0
+		case "[":
+			return &Vec{V: rd.seq(pos, ']')}, 0
+		case "{":
+			return rd.hash(pos, func(kvs []Any) Any { return newForms(kvs) }, '}'), 0
+		case "#pmap{":
+			return rd.hash(pos, func(kvs []Any) Any { return pmapAssoc(EmptyPMap, kvs) }, '}'), 0
+		default: // "#pvec["
+			return pvecConj(EmptyPVec, rd.seq(pos, ']')), 0
+		}
+	}
+}
+
+// node is like datum, but for ParseSource: it returns comments as Nodes,
+// and keeps the original text of atoms.
+func (rd *Reader) node() (n *Node, close rune) {
+	kind, text, pos := rd.token()
+	switch kind {
+	case tokEOF:
+		return nil, eof
+	case tokClose:
+		rd.at = pos
+		return nil, rune(text[0])
+	case tokComment:
+		return &Node{Text: text, Comment: true, Pos: pos, End: rd.pos}, 0
+	case tokSkip:
+		// A datum comment is kept verbatim, with what it comments out.
+		rd.nest(pos)
+		for {
+			d, close := rd.node()
+			if close == eof {
+				rd.incomplete(pos)
+			} else if close != 0 {
+				rd.fail(pos, "nothing after #; before %q", close)
+			}
+			if !d.Comment {
+				rd.depth--
+				return &Node{Text: rd.src[pos.Offset:d.End.Offset], Comment: true, Pos: pos, End: d.End}, 0
+			}
+		}
+	case tokAtom:
+		return &Node{Text: text, Pos: pos, End: rd.pos}, 0
+	}
+	want := closer(text)
+	n = &Node{Open: text, Close: string(want), Pos: pos}
+	rd.nest(pos)
+	for {
+		kid, c := rd.node()
+		switch c {
+		case 0:
+			n.Kids = append(n.Kids, kid)
+		case want:
+			rd.depth--
+			n.End = rd.pos
+			return n, 0
+		case eof:
+			rd.incomplete(pos)
+		default:
+			rd.fail(rd.at, "expected %q but got %q", want, c)
+		}
+	}
+}
+
+// seq reads forms up to the close bracket.
+func (rd *Reader) seq(pos scanner.Position, close rune) []Any {
+	var z []Any
+	rd.open++
+	rd.nest(pos)
+	for {
+		x, c := rd.datum()
+		switch c {
+		case 0:
+			z = append(z, x)
+		case close:
+			rd.open--
+			rd.depth--
+			return z
+		case eof:
+			rd.incomplete(pos)
+		default:
+			rd.fail(rd.at, "expected %q but got %q", close, c)
+		}
+	}
+}
+
+// hash reads keys and values up to the close bracket, and builds a map of them.
+func (rd *Reader) hash(pos scanner.Position, build func([]Any) Any, close rune) Any {
+	kvs := rd.seq(pos, close)
+	defer func() {
+		if r := recover(); r != nil {
+			rd.fail(pos, "%v", r)
+		}
+	}()
+	return build(kvs)
+}
+
+// word reads the rest of a symbol or number.
+func (rd *Reader) word(prefix string) string {
+	var buf strings.Builder
+	buf.WriteString(prefix)
+	for !isDelimiter(rd.peek()) {
+		buf.WriteRune(rd.next())
+	}
+	return buf.String()
+}
+
+// str reads the rest of a string or barred symbol, with backslash escapes
+// except in `raw strings`, which may span lines.
+func (rd *Reader) str(pos scanner.Position, quote string) string {
+	var buf strings.Builder
+	buf.WriteString(quote)
+	for {
+		r := rd.next()
+		switch {
+		case r == eof:
+			rd.incomplete(pos)
+		case r == '\n' && quote == `"`:
+			rd.fail(pos, "newline in string")
+		case r == '\\' && quote != "`":
+			buf.WriteRune(r)
+			r = rd.next()
+			if r == eof {
+				rd.incomplete(pos)
+			}
+		case string(r) == quote:
+			buf.WriteRune(r)
+			return buf.String()
+		}
+		buf.WriteRune(r)
+	}
+}
+
+// line reads the rest of the line, without the newline.
+func (rd *Reader) line() string {
+	var buf strings.Builder
+	for r := rd.peek(); r != '\n' && r != eof; r = rd.peek() {
+		buf.WriteRune(rd.next())
+	}
+	return buf.String()
+}
+
+// block reads a comment up to end, which nests if begin is not empty.
+func (rd *Reader) block(pos scanner.Position, end, begin string) string {
+	var buf strings.Builder
+	depth := 1
+	prev := rune(0)
+	for depth > 0 {
+		r := rd.next()
+		buf.WriteRune(r)
+		switch {
+		case r == eof:
+			rd.incomplete(pos)
+		case string([]rune{prev, r}) == end:
+			depth--
+			r = 0
+		case begin != "" && string([]rune{prev, r}) == begin:
+			depth++
+			r = 0
+		}
+		prev = r
+	}
+	return buf.String()
+}
+
+// atom converts the text of an atom, which may be a mistake.
+func (rd *Reader) atom(pos scanner.Position, text string) (z Any) {
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(readFailure); ok {
+				panic(r)
+			}
+			rd.fail(pos, "%v", r)
+		}
+	}()
+	z, err := readAtom(text)
+	if err != nil {
+		rd.fail(pos, "%v", err)
+	}
+	return z
+}
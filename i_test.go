@@ -0,0 +1,152 @@
+package snoc
+
+import (
+	"context"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReader(t *testing.T) {
+	rd := NewReader(strings.NewReader(`(a [b] {c 1}) ; comment
+  "str" #\x41 #pvec[1 2] )
+  (b`), "TestReader")
+
+	wants := []string{`(a [b] {c 1})`, `str`, `#\A`, `#pvec[1 2]`}
+	for _, want := range wants {
+		x, err := rd.Read()
+		if err != nil {
+			t.Fatalf("Read error: %v", err)
+		}
+		if got := Stringify(x); got != want {
+			t.Errorf("Got %s, wanted %s", got, want)
+		}
+	}
+
+	_, err := rd.Read()
+	var se *SyntaxError
+	if !errors.As(err, &se) || errors.Is(err, ErrIncomplete) || se.Pos.Line != 2 || se.Pos.Column != 26 {
+		t.Errorf("Wanted syntax error at 2:26, got %v", err)
+	}
+	_, err = rd.Read()
+	if !errors.Is(err, ErrIncomplete) || err.Error() != "TestReader:3:3: incomplete form" {
+		t.Errorf("Wanted incomplete form at 3:3, got %v", err)
+	}
+	_, err = rd.Read()
+	if err != io.EOF {
+		t.Errorf("Wanted EOF, got %v", err)
+	}
+}
+
+// TestReaderStreams checks that Read returns a form without reading past it.
+func TestReaderStreams(t *testing.T) {
+	pr, pw := io.Pipe()
+	rd := NewReader(pr, "TestReaderStreams")
+	go pw.Write([]byte("(+ 1\n 2) "))
+	x, err := rd.Read()
+	if err != nil || Stringify(x) != "(+ 1 2)" {
+		t.Errorf("Got %v, %v", x, err)
+	}
+	go pw.Write([]byte("three\n"))
+	x, err = rd.Read()
+	if err != nil || Stringify(x) != "three" {
+		t.Errorf("Got %v, %v", x, err)
+	}
+	pw.Close()
+	if _, err := rd.Read(); err != io.EOF {
+		t.Errorf("Wanted EOF, got %v", err)
+	}
+}
+
+// TestReaderRecovers checks that nothing inside a broken form is evaluated.
+func TestReaderRecovers(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(list 1 ] (display "LAUNCHED\n")) (display "ok")`, "ok"},
+		{"(list 1 ]\n  (display \"LAUNCHED\\n\")\n  [(display \"LAUNCHED\\n\")])\n(display \"ok\")", "ok"},
+		{"(list (vector 1 } (display \"LAUNCHED\\n\")) \"])\" 2)\n(display \"ok\")", "ok"},
+		{`(list #\ (display "LAUNCHED\n") ] (display "LAUNCHED\n")) (display "ok")`, "ok"},
+		{`(list {1} (display "LAUNCHED\n")) (display "ok")`, "ok"},
+		{`(list 1 ] (display "LAUNCHED\n")`, ""},
+	}
+	for _, sc := range scenarios {
+		var out strings.Builder
+		terp := NewTerp()
+		terp.Out = &out
+		Repl(terp, strings.NewReader(sc.program))
+		if got := out.String(); got != sc.want {
+			t.Errorf("For %q, got output %q, wanted %q", sc.program, got, sc.want)
+		}
+	}
+}
+
+// TestReaderNesting reads forms nested too deep, without evaluating them.
+func TestReaderNesting(t *testing.T) {
+	deep := strings.Repeat("(", 3000000)
+	for _, src := range []string{
+		deep + "x" + strings.Repeat(")", 3000000) + " 5",
+		strings.Repeat("[", 3000000) + "] 5",
+		strings.Repeat("#; ", 3000000) + "5",
+	} {
+		rd := NewReader(strings.NewReader(src), "deep")
+		_, err := rd.Read()
+		var syntax *SyntaxError
+		var limit *LimitError
+		if !errors.As(err, &syntax) || !errors.As(err, &limit) || limit.Limit != "nesting" {
+			t.Errorf("For %.10q, got %v, wanted exceeding the nesting limit", src, err)
+		}
+		// It fails at the first bracket or #; past the limit.
+		if syntax != nil && syntax.Pos.Column != MaxNesting+2 && syntax.Pos.Column != 3*MaxNesting+4 {
+			t.Errorf("For %.10q, got column %d", src, syntax.Pos.Column)
+		}
+	}
+
+	// After the mistake, the reader goes on after the broken form.
+	rd := NewReader(strings.NewReader(deep+strings.Repeat(")", 3000000)+" 5"), "deep")
+	if _, err := rd.Read(); err == nil {
+		t.Errorf("Read deep form")
+	}
+	if x, err := rd.Read(); x != 5.0 || err != nil {
+		t.Errorf("Got %v, %v, wanted 5", x, err)
+	}
+
+	// Neither evaluating nor formatting source reads too deep.
+	terp := NewTerp()
+	terp.Limits = Limits{MaxSteps: 1000, MaxDepth: 100, MaxAlloc: 100000}
+	var limit *LimitError
+	if _, err := terp.EvalString(context.Background(), deep); !errors.As(err, &limit) || limit.Limit != "nesting" {
+		t.Errorf("EvalString got %v", err)
+	}
+	func() {
+		defer func() {
+			if err, ok := recover().(error); !ok || !errors.As(err, &limit) || limit.Limit != "nesting" {
+				t.Errorf("ParseSource got %v", err)
+			}
+		}()
+		ParseSource(deep, "deep")
+	}()
+
+	// Forms just within the limit are fine.
+	ok := strings.Repeat("(", MaxNesting+1) + strings.Repeat(")", MaxNesting+1)
+	if _, err := NewReader(strings.NewReader(ok), "ok").Read(); err != nil {
+		t.Errorf("Got %v", err)
+	}
+}
+
+func TestReaderGoComments(t *testing.T) {
+	src := "(quote (a // b\n c /* d */))"
+	for _, goComments := range []bool{true, false} {
+		terp := NewTerp()
+		terp.GoComments = goComments
+		want := "(a c)"
+		if !goComments {
+			want = "(a // b c /* d */)"
+		}
+		if got := Stringify(Repl(terp, strings.NewReader(src))[0]); got != want {
+			t.Errorf("With GoComments %v, got %s, wanted %s", goComments, got, want)
+		}
+	}
+}
@@ -0,0 +1,109 @@
+// k.go: keywords
+
+package snoc
+
+import (
+	"sync"
+
+	. "github.com/strickyak/yak"
+)
+
+// Like symbols, keywords are shared by all Terps.
+var (
+	keywordMu    sync.RWMutex
+	keywordTable = make(map[string]*Keyword)
+)
+
+// InternKeyword returns the one Keyword with the name s (without the colon).
+// It is safe to call from many goroutines.
+func InternKeyword(s string) *Keyword {
+	keywordMu.RLock()
+	z, ok := keywordTable[s]
+	keywordMu.RUnlock()
+	if ok {
+		return z
+	}
+	keywordMu.Lock()
+	defer keywordMu.Unlock()
+	if z, ok := keywordTable[s]; ok {
+		return z
+	}
+	z = &Keyword{S: s}
+	keywordTable[s] = z
+	return z
+}
+
+// KeywordTable returns a copy of the keyword table, by name.
+// Like InternTable, it used to be the table itself.
+func KeywordTable() map[string]*Keyword {
+	keywordMu.RLock()
+	defer keywordMu.RUnlock()
+	z := make(map[string]*Keyword, len(keywordTable))
+	for s, k := range keywordTable {
+		z[s] = k
+	}
+	return z
+}
+
+func (o *Keyword) String() string {
+	return ":" + o.S
+}
+
+func ToKeyword(o Any) *Keyword {
+	switch t := o.(type) {
+	case *Keyword:
+		return t
+	}
+	Throw(o, "cannot Keyword")
+	return nil
+}
+
+func ToSym(o Any) *Sym {
+	switch t := o.(type) {
+	case *Sym:
+		return t
+	}
+	Throw(o, "cannot Sym")
+	return nil
+}
+
+var BuiltinKeywordPrims = map[string]func([]Any, *Env) Any{
+	"keyword?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(*Keyword)
+		return LispyBool(ok)
+	},
+	// (keyword->string :a) is "a", without the colon.
+	"keyword->string": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return ToKeyword(args[0]).S
+	},
+	"string->keyword": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return InternKeyword(ToStr(args[0]))
+	},
+	"keyword->symbol": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return Intern(ToKeyword(args[0]).S)
+	},
+	"symbol->keyword": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return InternKeyword(ToSym(args[0]).S)
+	},
+	// (plist-get plist key) or (plist-get plist key default)
+	// looks up a keyword in a property list like (:a 1 :b 2).
+	"plist-get": func(args []Any, env *Env) Any {
+		Must(len(args) == 2 || len(args) == 3)
+		list, ok := args[0].(*Pair)
+		if !ok {
+			Throw(args[0], "plist-get: not a list")
+		}
+		if v, ok := Get(list, ToKeyword(args[1])); ok {
+			return v
+		}
+		if len(args) == 3 {
+			return args[2]
+		}
+		return NIL
+	},
+}
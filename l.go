@@ -0,0 +1,249 @@
+// l.go: load, modules, and namespaces
+
+package snoc
+
+import (
+	_ "embed"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	. "github.com/strickyak/yak"
+)
+
+// SnocPath is the module search path from $SNOCPATH,
+// a list of directories like $PATH, or else just the current directory.
+func SnocPath() []string {
+	if p := os.Getenv("SNOCPATH"); p != "" {
+		return filepath.SplitList(p)
+	}
+	return []string{"."}
+}
+
+// Prelude is the standard library in snoc, which NewTerp loads into core.
+//
+//go:embed prelude.snoc
+var Prelude string
+
+// LoadFile evaluates the forms in a file as top-level forms,
+// and returns the value of the last one.
+func LoadFile(terp *Terp, filename string) Any {
+	r, err := os.Open(filename)
+	if err != nil {
+		Throw(filename, "cannot load: %v", err)
+	}
+	defer r.Close()
+	return Load(terp, r, filename)
+}
+
+// Load evaluates the forms read from r as top-level forms,
+// and returns the value of the last one.
+func Load(terp *Terp, r io.Reader, filename string) Any {
+	rd := NewReader(r, filename)
+	rd.Where = terp.Where
+	rd.GoComments = terp.GoComments
+	var z Any = NIL
+	for {
+		x, err := rd.Read()
+		if err == io.EOF {
+			return z
+		}
+		if err != nil {
+			panic(err)
+		}
+		z = EvalTop(terp, x)
+	}
+}
+
+// FindModule finds the file name.snoc in the directories of terp.Path.
+func FindModule(terp *Terp, name string) string {
+	for _, dir := range terp.Path {
+		filename := filepath.Join(dir, filepath.FromSlash(name)+".snoc")
+		if _, err := os.Stat(filename); err == nil {
+			return filename
+		}
+	}
+	Throw(Intern(name), "cannot find module in SNOCPATH %q:", strings.Join(terp.Path, string(filepath.ListSeparator)))
+	return ""
+}
+
+// NewNamespace makes a namespace that refers to everything in core.
+func (terp *Terp) NewNamespace(name string) *Module {
+	core := terp.Modules["core"]
+	m := &Module{
+		Name:    name,
+		Globals: make(map[*Sym]Any, len(core.Globals)),
+		Aliases: map[string]*Module{"core": core},
+	}
+	for k, v := range core.Globals {
+		m.Globals[k] = v
+	}
+	return m
+}
+
+// Enter makes m the namespace of top-level forms,
+// until the returned func restores the previous one.
+func (terp *Terp) Enter(m *Module) (restore func()) {
+	saved := terp.NS
+	terp.NS, terp.Globals = m, m.Globals
+	return func() {
+		terp.NS, terp.Globals = saved, saved.Globals
+	}
+}
+
+// Lookup finds the value of a symbol in the namespace.
+// A qualified symbol like str/join that is not defined here
+// names an export of the module imported as str.
+func (m *Module) Lookup(sym *Sym) (Any, bool) {
+	if v, ok := m.Globals[sym]; ok {
+		return v, true
+	}
+	i := strings.IndexByte(sym.S, '/')
+	if i <= 0 || i == len(sym.S)-1 {
+		return nil, false
+	}
+	other, ok := m.Aliases[sym.S[:i]]
+	if !ok {
+		return nil, false
+	}
+	name := Intern(sym.S[i+1:])
+	if !other.Exported(name) {
+		return nil, false
+	}
+	v, ok := other.Globals[name]
+	return v, ok
+}
+
+func (m *Module) Exported(sym *Sym) bool {
+	for _, e := range m.Exports {
+		if e == sym {
+			return true
+		}
+	}
+	return false
+}
+
+// Require returns the module with the name, loading it the first time.
+func Require(terp *Terp, name string) *Module {
+	if m, ok := terp.Modules[name]; ok {
+		return m
+	}
+	for i, m := range terp.Loading {
+		if m.Name == name {
+			var names []string
+			for _, e := range terp.Loading[i:] {
+				names = append(names, e.Name)
+			}
+			Throw(Intern(name), "require cycle: %s ->", strings.Join(names, " -> "))
+		}
+	}
+
+	m := terp.NewNamespace(name)
+	m.Filename = FindModule(terp, name)
+	defer terp.Enter(m)()
+	terp.Loading = append(terp.Loading, m)
+	defer func() { terp.Loading = terp.Loading[:len(terp.Loading)-1] }()
+
+	LoadFile(terp, m.Filename)
+	if !m.Declared {
+		Throw(m.Filename, "module file does not declare (module %s ...):", name)
+	}
+	for _, sym := range m.Exports {
+		if _, ok := m.Globals[sym]; !ok {
+			Throw(sym, "module %s does not define export", name)
+		}
+	}
+	terp.Modules[name] = m
+	return m
+}
+
+var BuiltinLoadPrims = map[string]func([]Any, *Env) Any{
+	// (load filename) evaluates the file in the current namespace.
+	"load": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		defer env.Terp.Enter(env.Namespace())()
+		return LoadFile(env.Terp, ToStr(args[0]))
+	},
+}
+
+var BuiltinModuleSpecials = map[string]func([]Any, *Env) Any{
+	// (module name (export sym...)) begins a module file.
+	// Outside of require, it does nothing.
+	"module": func(args []Any, env *Env) Any {
+		if len(args) == 0 {
+			Throw(NIL, "module needs a name")
+		}
+		name, ok := args[0].(*Sym)
+		if !ok {
+			Throw(args[0], "module needs a symbol for its name")
+		}
+		loading := env.Terp.Loading
+		if len(loading) == 0 {
+			return NIL
+		}
+		m := loading[len(loading)-1]
+		if m.Declared {
+			Throw(name, "module declared twice in %s:", m.Filename)
+		}
+		if name.S != m.Name {
+			Throw(name, "wanted module %s but %s declares", m.Name, m.Filename)
+		}
+		m.Declared = true
+		for _, clause := range args[1:] {
+			p, ok := clause.(*Pair)
+			if !ok || p == NIL || p.H != Intern("export") {
+				Throw(clause, "module wants (export sym...) but got")
+			}
+			for _, e := range ListToVec(p.T) {
+				sym, ok := e.(*Sym)
+				if !ok {
+					Throw(e, "export needs symbols")
+				}
+				m.Exports = append(m.Exports, sym)
+			}
+		}
+		return NIL
+	},
+	// (require name...) loads modules, if not yet loaded,
+	// and defines their exports in the current namespace.
+	"require": func(args []Any, env *Env) Any {
+		for _, a := range args {
+			name, ok := a.(*Sym)
+			if !ok {
+				Throw(a, "require needs module names")
+			}
+			m := Require(env.Terp, name.S)
+			globals := env.Namespace().Globals
+			for _, sym := range m.Exports {
+				globals[sym] = m.Globals[sym]
+			}
+		}
+		return NIL
+	},
+	// (import name) loads a module, if not yet loaded, so that its exports
+	// can be used qualified, like name/sym.  (import name :as alias)
+	// uses the alias instead of the name, like alias/sym.
+	"import": func(args []Any, env *Env) Any {
+		if len(args) != 1 && len(args) != 3 {
+			Throw(VecToList(args), "import wants a name and maybe :as alias, but got")
+		}
+		name, ok := args[0].(*Sym)
+		if !ok {
+			Throw(args[0], "import needs a module name")
+		}
+		alias := name
+		if len(args) == 3 {
+			alias, ok = args[2].(*Sym)
+			if args[1] != InternKeyword("as") || !ok {
+				Throw(VecToList(args), "import wants a name and maybe :as alias, but got")
+			}
+		}
+		ns := env.Namespace()
+		if ns.Aliases == nil {
+			ns.Aliases = make(map[string]*Module)
+		}
+		ns.Aliases[alias.S] = Require(env.Terp, name.S)
+		return NIL
+	},
+}
@@ -0,0 +1,109 @@
+package snoc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestRequire(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"geom.snoc": `(module geom (export area))
+			(display "loading geom")
+			(defun sq (x) (* x x))
+			(defun area (r) (* 3 (sq r)))`,
+		"a.snoc":      "(module a (export)) (require b)",
+		"b.snoc":      "(module b (export)) (require a)",
+		"helper.snoc": `(defun helper () 42)`,
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var out strings.Builder
+	terp := NewTerp()
+	terp.Out = &out
+	terp.Path = []string{dir}
+	results := Repl(terp, strings.NewReader(`
+		(defun sq (x) (list x x))
+		(require geom)
+		(require geom)
+		(list (area 2) (sq 2))
+		(defun sq-geom () (sq 1))
+		(require a)
+		(load "`+filepath.Join(dir, "helper.snoc")+`")
+		(helper)
+		(require nowhere)
+	`))
+
+	if got := Stringify(results[3]); got != "(12 (2 2))" {
+		t.Errorf("Got %s, wanted (12 (2 2))", got)
+	}
+	if got := out.String(); got != "loading geom" {
+		t.Errorf("Module was not loaded once: output %q", got)
+	}
+	if got := Stringify(results[5]); !strings.Contains(got, "require cycle: a -> b -> a") {
+		t.Errorf("Got %s, wanted a require cycle", got)
+	}
+	if got := Stringify(results[7]); got != "42" {
+		t.Errorf("Got %s from load, wanted 42", got)
+	}
+	if got := Stringify(results[8]); !strings.Contains(got, "cannot find module") {
+		t.Errorf("Got %s, wanted cannot find module", got)
+	}
+	if len(terp.Loading) != 0 {
+		t.Errorf("Still loading %v", terp.Loading)
+	}
+}
+
+func TestNamespaces(t *testing.T) {
+	dir := t.TempDir()
+	files := map[string]string{
+		"str.snoc": `(module str (export join))
+			(defun helper (a b) (list a b))
+			(defun join (a b) (helper a b))`,
+		"nums.snoc": `(module nums (export twice))
+			(defun helper (x) (* 2 x))
+			(defun twice (x) (helper x))`,
+	}
+	for name, text := range files {
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(text), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	terp := NewTerp()
+	terp.Path = []string{dir}
+	results := Repl(terp, strings.NewReader(`
+		(import str)
+		(import nums :as n)
+		(list (str/join 1 2) (n/twice 3))
+		(defun head (x) (quote mine))
+		(list (head (list 1 2)) (core/head (list 1 2)))
+		(str/helper 1 2)
+		(nums/twice 3)
+		(import str :with n)
+	`))
+
+	want := []string{"", "", "((1 2) 6)", "", "(mine 1)", "", "", ""}
+	for i, w := range want {
+		if w == "" {
+			continue
+		}
+		if got := Stringify(results[i]); got != w {
+			t.Errorf("Form %d: got %s, wanted %s", i, got, w)
+		}
+	}
+	for _, i := range []int{5, 6, 7} {
+		if got := Stringify(results[i]); !strings.Contains(got, "*ERROR*") {
+			t.Errorf("Form %d: got %s, wanted an error", i, got)
+		}
+	}
+	if _, ok := terp.Modules["user"].Globals[Intern("helper")]; ok {
+		t.Errorf("helper leaked into user")
+	}
+}
@@ -0,0 +1,516 @@
+// m.go: persistent maps (HAMT) and vectors (bit-partitioned tries)
+
+package snoc
+
+import (
+	"math/bits"
+	"strings"
+
+	. "github.com/strickyak/yak"
+)
+
+// A PMap is a hash array mapped trie; updates copy only the path
+// from the root to the changed slot, so old versions stay valid.
+
+type hamtNode struct {
+	bitmap  uint32
+	slots   []hamtSlot
+	collide bool // All slots have the same full hash.
+}
+
+type hamtSlot struct {
+	hash  uint32
+	key   Any
+	val   Any
+	child *hamtNode // If not nil, this slot holds a subtree instead of key & val.
+}
+
+var EmptyPMap = &PMap{}
+
+// hashKey folds the 64-bit Hash, so keys are compared with Equal.
+func hashKey(k Any) uint32 {
+	h := HashCode(k)
+	return uint32(h ^ h>>32)
+}
+
+func (o *PMap) Get(k Any) (Any, bool) {
+	if o.Root == nil {
+		return nil, false
+	}
+	return o.Root.get(0, hashKey(k), k)
+}
+
+func (o *PMap) Assoc(k Any, v Any) *PMap {
+	slot := hamtSlot{hash: hashKey(k), key: k, val: v}
+	if o.Root == nil {
+		return &PMap{Root: &hamtNode{bitmap: 1 << (slot.hash & 31), slots: []hamtSlot{slot}}, Count: 1}
+	}
+	root, added := o.Root.assoc(0, slot)
+	z := &PMap{Root: root, Count: o.Count}
+	if added {
+		z.Count++
+	}
+	return z
+}
+
+func (o *PMap) Dissoc(k Any) *PMap {
+	if o.Root == nil {
+		return o
+	}
+	root, removed := o.Root.dissoc(0, hashKey(k), k)
+	if !removed {
+		return o
+	}
+	return &PMap{Root: root, Count: o.Count - 1}
+}
+
+// Each calls fn on every entry, in hash order.
+func (o *PMap) Each(fn func(k, v Any)) {
+	if o.Root != nil {
+		o.Root.each(fn)
+	}
+}
+
+func (n *hamtNode) index(bit uint32) int {
+	return bits.OnesCount32(n.bitmap & (bit - 1))
+}
+
+func (n *hamtNode) get(shift uint, hash uint32, k Any) (Any, bool) {
+	if n.collide {
+		for _, s := range n.slots {
+			if Equal(s.key, k) {
+				return s.val, true
+			}
+		}
+		return nil, false
+	}
+	bit := uint32(1) << ((hash >> shift) & 31)
+	if n.bitmap&bit == 0 {
+		return nil, false
+	}
+	s := n.slots[n.index(bit)]
+	if s.child != nil {
+		return s.child.get(shift+5, hash, k)
+	}
+	if Equal(s.key, k) {
+		return s.val, true
+	}
+	return nil, false
+}
+
+func (n *hamtNode) withSlot(i int, s hamtSlot) *hamtNode {
+	slots := append([]hamtSlot(nil), n.slots...)
+	slots[i] = s
+	return &hamtNode{bitmap: n.bitmap, slots: slots, collide: n.collide}
+}
+
+func (n *hamtNode) assoc(shift uint, slot hamtSlot) (*hamtNode, bool) {
+	if n.collide {
+		for i, s := range n.slots {
+			if Equal(s.key, slot.key) {
+				return n.withSlot(i, slot), false
+			}
+		}
+		slots := append(append([]hamtSlot(nil), n.slots...), slot)
+		return &hamtNode{slots: slots, collide: true}, true
+	}
+	bit := uint32(1) << ((slot.hash >> shift) & 31)
+	i := n.index(bit)
+	if n.bitmap&bit == 0 {
+		slots := make([]hamtSlot, 0, len(n.slots)+1)
+		slots = append(append(append(slots, n.slots[:i]...), slot), n.slots[i:]...)
+		return &hamtNode{bitmap: n.bitmap | bit, slots: slots}, true
+	}
+	s := n.slots[i]
+	switch {
+	case s.child != nil:
+		child, added := s.child.assoc(shift+5, slot)
+		return n.withSlot(i, hamtSlot{child: child}), added
+	case Equal(s.key, slot.key):
+		return n.withSlot(i, slot), false
+	}
+	return n.withSlot(i, hamtSlot{child: mergeSlots(shift+5, s, slot)}), true
+}
+
+func mergeSlots(shift uint, a, b hamtSlot) *hamtNode {
+	if shift >= 32 {
+		return &hamtNode{slots: []hamtSlot{a, b}, collide: true}
+	}
+	ia, ib := (a.hash>>shift)&31, (b.hash>>shift)&31
+	if ia == ib {
+		return &hamtNode{bitmap: 1 << ia, slots: []hamtSlot{{child: mergeSlots(shift+5, a, b)}}}
+	}
+	if ia > ib {
+		a, b = b, a
+	}
+	return &hamtNode{bitmap: 1<<ia | 1<<ib, slots: []hamtSlot{a, b}}
+}
+
+// dissoc returns nil for the node if it becomes empty.
+func (n *hamtNode) dissoc(shift uint, hash uint32, k Any) (*hamtNode, bool) {
+	if n.collide {
+		for i, s := range n.slots {
+			if Equal(s.key, k) {
+				if len(n.slots) == 1 {
+					return nil, true
+				}
+				slots := append(append([]hamtSlot(nil), n.slots[:i]...), n.slots[i+1:]...)
+				return &hamtNode{slots: slots, collide: true}, true
+			}
+		}
+		return n, false
+	}
+	bit := uint32(1) << ((hash >> shift) & 31)
+	if n.bitmap&bit == 0 {
+		return n, false
+	}
+	i := n.index(bit)
+	s := n.slots[i]
+	if s.child != nil {
+		child, removed := s.child.dissoc(shift+5, hash, k)
+		if !removed {
+			return n, false
+		}
+		if child != nil {
+			return n.withSlot(i, hamtSlot{child: child}), true
+		}
+	} else if !Equal(s.key, k) {
+		return n, false
+	}
+	if len(n.slots) == 1 {
+		return nil, true
+	}
+	slots := append(append([]hamtSlot(nil), n.slots[:i]...), n.slots[i+1:]...)
+	return &hamtNode{bitmap: n.bitmap &^ bit, slots: slots}, true
+}
+
+func (n *hamtNode) each(fn func(k, v Any)) {
+	for _, s := range n.slots {
+		if s.child != nil {
+			s.child.each(fn)
+		} else {
+			fn(s.key, s.val)
+		}
+	}
+}
+
+func (o *PMap) String() string {
+	return o.stringAt(0)
+}
+
+func (o *PMap) stringAt(depth int) string {
+	var buf strings.Builder
+	buf.WriteString("#pmap{")
+	first := true
+	o.Each(func(k, v Any) {
+		if !first {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(stringify(k, depth+1))
+		buf.WriteByte(' ')
+		buf.WriteString(stringify(v, depth+1))
+		first = false
+	})
+	buf.WriteString("}")
+	return buf.String()
+}
+
+// A PVec is a 32-way trie of its elements, plus a tail of up to 32
+// elements that have not been pushed into the trie yet.
+
+type pvecNode struct {
+	array []Any // Each is a *pvecNode, except at the bottom level.
+}
+
+var EmptyPVec = &PVec{Shift: 5, Root: &pvecNode{}}
+
+func (o *PVec) tailOffset() int {
+	if o.Count < 32 {
+		return 0
+	}
+	return ((o.Count - 1) >> 5) << 5
+}
+
+func (o *PVec) arrayFor(i int) []Any {
+	if i >= o.tailOffset() {
+		return o.Tail
+	}
+	node := o.Root
+	for level := o.Shift; level > 0; level -= 5 {
+		node = node.array[(i>>level)&31].(*pvecNode)
+	}
+	return node.array
+}
+
+func (o *PVec) Nth(i int) Any {
+	if i < 0 || i >= o.Count {
+		Throw(float64(i), "PVec index out of range [0, %d)", o.Count)
+	}
+	return o.arrayFor(i)[i&31]
+}
+
+func (o *PVec) Conj(x Any) *PVec {
+	if o.Count-o.tailOffset() < 32 {
+		tail := append(append([]Any(nil), o.Tail...), x)
+		return &PVec{Count: o.Count + 1, Shift: o.Shift, Root: o.Root, Tail: tail}
+	}
+	// The tail is full, so push it into the trie.
+	tailNode := &pvecNode{array: o.Tail}
+	shift := o.Shift
+	var root *pvecNode
+	if (o.Count >> 5) > (1 << o.Shift) {
+		root = &pvecNode{array: []Any{o.Root, newPath(o.Shift, tailNode)}}
+		shift += 5
+	} else {
+		root = o.pushTail(o.Shift, o.Root, tailNode)
+	}
+	return &PVec{Count: o.Count + 1, Shift: shift, Root: root, Tail: []Any{x}}
+}
+
+func newPath(level uint, node *pvecNode) *pvecNode {
+	if level == 0 {
+		return node
+	}
+	return &pvecNode{array: []Any{newPath(level-5, node)}}
+}
+
+func (o *PVec) pushTail(level uint, parent *pvecNode, tailNode *pvecNode) *pvecNode {
+	i := ((o.Count - 1) >> level) & 31
+	var insert *pvecNode
+	if level == 5 {
+		insert = tailNode
+	} else if i < len(parent.array) {
+		insert = o.pushTail(level-5, parent.array[i].(*pvecNode), tailNode)
+	} else {
+		insert = newPath(level-5, tailNode)
+	}
+	array := append([]Any(nil), parent.array...)
+	if i < len(array) {
+		array[i] = insert
+	} else {
+		array = append(array, insert)
+	}
+	return &pvecNode{array: array}
+}
+
+func (o *PVec) Assoc(i int, x Any) *PVec {
+	if i == o.Count {
+		return o.Conj(x)
+	}
+	if i < 0 || i > o.Count {
+		Throw(float64(i), "PVec index out of range [0, %d]", o.Count)
+	}
+	if i >= o.tailOffset() {
+		tail := append([]Any(nil), o.Tail...)
+		tail[i&31] = x
+		return &PVec{Count: o.Count, Shift: o.Shift, Root: o.Root, Tail: tail}
+	}
+	return &PVec{Count: o.Count, Shift: o.Shift, Root: assocPath(o.Shift, o.Root, i, x), Tail: o.Tail}
+}
+
+func assocPath(level uint, node *pvecNode, i int, x Any) *pvecNode {
+	array := append([]Any(nil), node.array...)
+	if level == 0 {
+		array[i&31] = x
+	} else {
+		j := (i >> level) & 31
+		array[j] = assocPath(level-5, node.array[j].(*pvecNode), i, x)
+	}
+	return &pvecNode{array: array}
+}
+
+// Pop removes the last element.
+func (o *PVec) Pop() *PVec {
+	switch {
+	case o.Count == 0:
+		Throw(o, "cannot Pop empty PVec")
+	case o.Count == 1:
+		return EmptyPVec
+	case o.Count-o.tailOffset() > 1:
+		tail := append([]Any(nil), o.Tail[:len(o.Tail)-1]...)
+		return &PVec{Count: o.Count - 1, Shift: o.Shift, Root: o.Root, Tail: tail}
+	}
+	tail := o.arrayFor(o.Count - 2)
+	root := o.popTail(o.Shift, o.Root)
+	shift := o.Shift
+	if root == nil {
+		root = &pvecNode{}
+	}
+	if shift > 5 && len(root.array) == 1 {
+		root = root.array[0].(*pvecNode)
+		shift -= 5
+	}
+	return &PVec{Count: o.Count - 1, Shift: shift, Root: root, Tail: tail}
+}
+
+// popTail returns nil for the node if it becomes empty.
+func (o *PVec) popTail(level uint, node *pvecNode) *pvecNode {
+	i := ((o.Count - 2) >> level) & 31
+	if level > 5 {
+		child := o.popTail(level-5, node.array[i].(*pvecNode))
+		if child == nil && i == 0 {
+			return nil
+		}
+		array := append([]Any(nil), node.array[:i]...)
+		if child != nil {
+			array = append(array, child)
+		}
+		return &pvecNode{array: array}
+	}
+	if i == 0 {
+		return nil
+	}
+	return &pvecNode{array: append([]Any(nil), node.array[:i]...)}
+}
+
+func (o *PVec) ToSlice() []Any {
+	z := make([]Any, o.Count)
+	for i := range z {
+		z[i] = o.Nth(i)
+	}
+	return z
+}
+
+func (o *PVec) String() string {
+	return o.stringAt(0)
+}
+
+func (o *PVec) stringAt(depth int) string {
+	var buf strings.Builder
+	buf.WriteString("#pvec[")
+	for i, e := range o.ToSlice() {
+		if i > 0 {
+			buf.WriteByte(' ')
+		}
+		buf.WriteString(stringify(e, depth+1))
+	}
+	buf.WriteString("]")
+	return buf.String()
+}
+
+func ToPMap(o Any) *PMap {
+	switch t := o.(type) {
+	case *PMap:
+		return t
+	}
+	Throw(o, "cannot PMap")
+	return nil
+}
+
+func ToPVec(o Any) *PVec {
+	switch t := o.(type) {
+	case *PVec:
+		return t
+	}
+	Throw(o, "cannot PVec")
+	return nil
+}
+
+var BuiltinPersistentPrims = map[string]func([]Any, *Env) Any{
+	"pmap": func(args []Any, env *Env) Any {
+		return pmapAssoc(EmptyPMap, args)
+	},
+	"pmap?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(*PMap)
+		return LispyBool(ok)
+	},
+	"pmap-count": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(ToPMap(args[0]).Count)
+	},
+	// (pmap-get m k) throws if k is missing; (pmap-get m k default) does not.
+	"pmap-get": func(args []Any, env *Env) Any {
+		Must(len(args) == 2 || len(args) == 3)
+		v, ok := ToPMap(args[0]).Get(args[1])
+		if !ok {
+			if len(args) == 3 {
+				return args[2]
+			}
+			Throw(args[1], "pmap-get: key not found")
+		}
+		return v
+	},
+	// (pmap-assoc m k v ...) returns a new PMap with more entries.
+	"pmap-assoc": func(args []Any, env *Env) Any {
+		Must(len(args) >= 1)
+		return pmapAssoc(ToPMap(args[0]), args[1:])
+	},
+	// (pmap-dissoc m k ...) returns a new PMap without those keys.
+	"pmap-dissoc": func(args []Any, env *Env) Any {
+		Must(len(args) >= 1)
+		m := ToPMap(args[0])
+		for _, k := range args[1:] {
+			m = m.Dissoc(k)
+		}
+		return m
+	},
+	"pmap-keys": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		var z []Any
+		ToPMap(args[0]).Each(func(k, v Any) { z = append(z, k) })
+		Alloc(env, len(z))
+		return VecToList(z)
+	},
+	"pmap-values": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		var z []Any
+		ToPMap(args[0]).Each(func(k, v Any) { z = append(z, v) })
+		Alloc(env, len(z))
+		return VecToList(z)
+	},
+	"pvec": func(args []Any, env *Env) Any {
+		return pvecConj(EmptyPVec, args)
+	},
+	"pvec?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(*PVec)
+		return LispyBool(ok)
+	},
+	"pvec-count": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(ToPVec(args[0]).Count)
+	},
+	"pvec-nth": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		v := ToPVec(args[0])
+		return v.Nth(ToIndex(args[1], v.Count))
+	},
+	// (pvec-conj v x ...) returns a new PVec with more elements at the end.
+	"pvec-conj": func(args []Any, env *Env) Any {
+		Must(len(args) >= 1)
+		return pvecConj(ToPVec(args[0]), args[1:])
+	},
+	"pvec-assoc": func(args []Any, env *Env) Any {
+		MustLen(args, 3)
+		v := ToPVec(args[0])
+		return v.Assoc(ToIndex(args[1], v.Count+1), args[2])
+	},
+	"pvec-pop": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return ToPVec(args[0]).Pop()
+	},
+	"pvec->list": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ToPVec(args[0]).ToSlice()
+		Alloc(env, len(v))
+		return VecToList(v)
+	},
+}
+
+func pmapAssoc(m *PMap, kvs []Any) *PMap {
+	if len(kvs)%2 != 0 {
+		Throw(VecToList(kvs), "PMap needs an even number of keys and values")
+	}
+	for i := 0; i < len(kvs); i += 2 {
+		m = m.Assoc(kvs[i], kvs[i+1])
+	}
+	return m
+}
+
+func pvecConj(v *PVec, xs []Any) *PVec {
+	for _, x := range xs {
+		v = v.Conj(x)
+	}
+	return v
+}
@@ -0,0 +1,93 @@
+package snoc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestPMapKeepsOldVersions(t *testing.T) {
+	const n = 2000
+	versions := []*PMap{EmptyPMap}
+	for i := 0; i < n; i++ {
+		versions = append(versions, versions[i].Assoc(float64(i), i))
+	}
+	for v, m := range versions {
+		if m.Count != v {
+			t.Fatalf("version %d has Count %d", v, m.Count)
+		}
+		for i := 0; i < n; i++ {
+			got, ok := m.Get(float64(i))
+			if ok != (i < v) || ok && got != i {
+				t.Fatalf("version %d: Get(%d) = %v, %v", v, i, got, ok)
+			}
+		}
+	}
+
+	m := versions[n]
+	for i := 0; i < n; i += 2 {
+		m = m.Dissoc(float64(i))
+	}
+	if m.Count != n/2 {
+		t.Errorf("after Dissoc, Count = %d", m.Count)
+	}
+	if _, ok := m.Get(float64(10)); ok {
+		t.Errorf("after Dissoc, still found 10")
+	}
+	if got, _ := versions[n].Get(float64(10)); got != 10 {
+		t.Errorf("Dissoc changed the old version: %v", got)
+	}
+}
+
+func TestPVecKeepsOldVersions(t *testing.T) {
+	const n = 2000
+	versions := []*PVec{EmptyPVec}
+	for i := 0; i < n; i++ {
+		versions = append(versions, versions[i].Conj(i))
+	}
+	for v, vec := range versions {
+		if vec.Count != v {
+			t.Fatalf("version %d has Count %d", v, vec.Count)
+		}
+		for i := 0; i < v; i++ {
+			if got := vec.Nth(i); got != i {
+				t.Fatalf("version %d: Nth(%d) = %v", v, i, got)
+			}
+		}
+	}
+
+	changed := versions[n].Assoc(1500, "x").Assoc(1999, "y")
+	if changed.Nth(1500) != "x" || changed.Nth(1999) != "y" || versions[n].Nth(1500) != 1500 {
+		t.Errorf("Assoc failed or changed the old version")
+	}
+
+	vec := versions[n]
+	for i := n; i > 0; i-- {
+		vec = vec.Pop()
+		if vec.Count != i-1 || i > 1 && vec.Nth(i-2) != i-2 {
+			t.Fatalf("Pop to %d failed", i-1)
+		}
+	}
+}
+
+// TestPersistentLiterals checks that #pmap{} and #pvec[] evaluate their contents,
+// like {} and [].
+func TestPersistentLiterals(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`#pmap{:a (+ 1 2)}`, "#pmap{:a 3}"},
+		{`#pvec[(+ 1 2) "x" :k]`, `#pvec[3 x :k]`},
+		{`(pmap-get #pmap{(+ 1 1) (quote two)} 2)`, "two"},
+		{`(defun f (x) (let y (+ x 1) #pvec[x y #pmap{x y}]))
+		  (f 1)`, "#pvec[1 2 #pmap{1 2}]"},
+		{`#pvec[(head 1)]`, "*ERROR* *repl*:1:7: cannot Head 1"},
+		{`(pvec-count #pvec[])`, "0"},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
@@ -0,0 +1,123 @@
+// n.go: source nodes and formatter
+
+package snoc
+
+import (
+	"fmt"
+	"io"
+	"strings"
+)
+
+// ParseSource parses text into Nodes with positions, for reformatting.
+// Unlike ParseText, it keeps comments as Kids, and the original text of atoms.
+func ParseSource(text, filename string) []*Node {
+	rd := NewReader(strings.NewReader(text), filename)
+	rd.src = text
+	var z []*Node
+	for {
+		n, err := rd.readNode()
+		if err == io.EOF {
+			return z
+		}
+		if err != nil {
+			panic(err)
+		}
+		z = append(z, n)
+	}
+}
+
+// ParseCST parses text into a concrete syntax tree of Nodes with positions.
+// Comments are not Kids, but are attached to the Comments of a nearby Node:
+// comments on the lines before a node and one after it on the same line
+// go with that node, and comments at the end of a list go with the list.
+// Comments at the end of the text go with the last top-level node,
+// or if there is none, are returned as Comment nodes.
+func ParseCST(text, filename string) []*Node {
+	nodes, left := attachComments(ParseSource(text, filename))
+	if len(nodes) == 0 {
+		return left
+	}
+	last := nodes[len(nodes)-1]
+	last.Comments = append(last.Comments, left...)
+	return nodes
+}
+
+// attachComments removes comments from nodes and their Kids,
+// attaching them to Comments, and returns any left over at the end.
+func attachComments(nodes []*Node) (z []*Node, pending []*Node) {
+	for _, n := range nodes {
+		if n.Comment {
+			if len(pending) == 0 && len(z) > 0 && n.Pos.Line == z[len(z)-1].End.Line {
+				prev := z[len(z)-1]
+				prev.Comments = append(prev.Comments, n)
+			} else {
+				pending = append(pending, n)
+			}
+			continue
+		}
+		n.Comments = append(pending, n.Comments...)
+		pending = nil
+		if n.Open != "" {
+			var left []*Node
+			n.Kids, left = attachComments(n.Kids)
+			n.Comments = append(n.Comments, left...)
+		}
+		z = append(z, n)
+	}
+	return z, pending
+}
+
+// Data converts a Node to the data that ParseText would read from it.
+// Comments are ignored.
+func (n *Node) Data() Any {
+	if n.Open == "" {
+		x, err := readAtom(n.Text)
+		if err != nil {
+			panic(&SyntaxError{Pos: n.Pos, Err: err})
+		}
+		return x
+	}
+	var kids []Any
+	for _, k := range n.Kids {
+		if !k.Comment {
+			kids = append(kids, k.Data())
+		}
+	}
+	switch n.Open {
+	case "(":
+		return VecToList(kids)
+	case "[":
+		return &Vec{V: kids}
+	case "{":
+		return newForms(kids)
+	case "#pmap{":
+		return pmapAssoc(EmptyPMap, kids)
+	case "#pvec[":
+		return pvecConj(EmptyPVec, kids)
+	}
+	panic(fmt.Errorf("Unknown bracket %q at %v", n.Open, n.Pos))
+}
+
+// FormatSource reformats snoc source text with standard indentation,
+// keeping comments, and at most one blank line between top-level forms.
+func FormatSource(text, filename string, width int) string {
+	var buf strings.Builder
+	var prev *Node
+	for _, n := range ParseSource(text, filename) {
+		switch {
+		case prev == nil:
+		case n.Comment && n.Pos.Line == prev.End.Line:
+			buf.WriteString(" ")
+		case n.Pos.Line > prev.End.Line+1:
+			buf.WriteString("\n\n")
+		default:
+			buf.WriteString("\n")
+		}
+		buf.WriteString(PPNode(n, 0, width))
+		prev = n
+	}
+	if prev != nil {
+		buf.WriteString("\n")
+	}
+	return buf.String()
+}
@@ -0,0 +1,124 @@
+package snoc
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestFormatSource(t *testing.T) {
+	scenarios := []struct {
+		source string
+		want   string
+	}{
+		{"(a   b\n c)", "(a b c)\n"},
+		{"// Sums a list.\n(defun my-sum (aList) // One arg.\n  (if (null? aList) 0 // Base case.\n (+ (head aList) (my-sum (tail aList)))))\n\n\n\n(my-sum (list 1 2))  // Three.\n",
+			`// Sums a list.
+(defun my-sum (aList) // One arg.
+  (if (null? aList) 0 // Base case.
+      (+ (head aList)
+         (my-sum (tail aList)))))
+
+(my-sum (list 1 2)) // Three.
+`},
+		{"(list 1 2 // two\n)", "(list 1\n      2 // two\n)\n"},
+		{"{\"a\" /* one */ 1 \"b\" 2}", "{\"a\" /* one */\n   1\n \"b\" 2}\n"},
+		{"(let a 1.50 #pvec[1 2] #\\x `raw`)", "(let a 1.50 #pvec[1 2] #\\x `raw`)\n"},
+		{"; Lisp comments.\n(list 1 ; one\n #| two |# 2 #;(three\n  3))", "; Lisp comments.\n(list 1 ; one\n      #| two |#\n      2 #;(three\n  3))\n"},
+	}
+	for _, sc := range scenarios {
+		got := FormatSource(sc.source, "TestFormatSource", 40)
+		if got != sc.want {
+			t.Errorf("For %q, got\n%s\nwanted\n%s", sc.source, got, sc.want)
+		}
+		if again := FormatSource(got, "TestFormatSource", 40); again != got {
+			t.Errorf("Formatting is not idempotent: got\n%s\nthen\n%s", got, again)
+		}
+		if !Equal(VecToList(ParseText(got, "got")), VecToList(ParseText(sc.source, "source"))) {
+			t.Errorf("Formatting changed the meaning of %q", sc.source)
+		}
+	}
+}
+
+// TestPreludeIsFormatted checks that the prelude passes snoc fmt.
+func TestPreludeIsFormatted(t *testing.T) {
+	if got := FormatSource(Prelude, "prelude.snoc", DefaultWidth); got != Prelude {
+		t.Errorf("Run snoc fmt -w prelude.snoc; it would make\n%s", got)
+	}
+}
+
+func TestParseCST(t *testing.T) {
+	src := `// Squares.
+(defun sq (x) // One arg.
+  (* x x
+     /* dangling */))
+(sq 3)
+// The end.
+`
+	nodes := ParseCST(src, "TestParseCST")
+	if len(nodes) != 2 {
+		t.Fatalf("Got %d nodes, wanted 2", len(nodes))
+	}
+	for i, x := range ParseText(src, "TestParseCST") {
+		if !Equal(nodes[i].Data(), x) {
+			t.Errorf("Node %d has data %v, wanted %v", i, nodes[i].Data(), x)
+		}
+	}
+
+	comments := func(n *Node) (z []string) {
+		for _, c := range n.Comments {
+			z = append(z, c.Text)
+		}
+		return
+	}
+	defun, sq, body := nodes[0], nodes[0].Kids[2], nodes[0].Kids[3]
+	if got := comments(defun); len(got) != 1 || got[0] != "// Squares." {
+		t.Errorf("defun has comments %q", got)
+	}
+	if got := comments(sq); len(got) != 1 || got[0] != "// One arg." {
+		t.Errorf("params have comments %q", got)
+	}
+	if got := comments(body); len(got) != 1 || got[0] != "/* dangling */" {
+		t.Errorf("body has comments %q", got)
+	}
+	if got := comments(nodes[1]); len(got) != 1 || got[0] != "// The end." {
+		t.Errorf("last form has comments %q", got)
+	}
+
+	if body.Pos.Line != 3 || body.Pos.Column != 3 || body.End.Line != 4 || body.End.Column != 21 {
+		t.Errorf("body is at %v to %v", body.Pos, body.End)
+	}
+}
+
+// TestParseSourceAgrees checks that the formatter reads what the Reader reads.
+func TestParseSourceAgrees(t *testing.T) {
+	srcs := []string{
+		`(a :|b c| |d e| #\( #\space "f\"g" ` + "`h\\`" + `)`,
+		`#pmap{:a [1 2]} #pvec[#;x y] {"k" (z)}`,
+		"(a #| b |# // c\n d /* e */) ; f",
+	}
+	for _, src := range srcs {
+		xs := ParseText(src, "TestParseSourceAgrees")
+		nodes := ParseCST(src, "TestParseSourceAgrees")
+		if len(nodes) != len(xs) {
+			t.Errorf("For %s, got %d nodes, wanted %d", src, len(nodes), len(xs))
+			continue
+		}
+		for i, x := range xs {
+			if got := nodes[i].Data(); !Equal(got, x) {
+				t.Errorf("For %s, node %d has data %v, wanted %v", src, i, got, x)
+			}
+		}
+	}
+
+	for _, src := range []string{"(a ]", "(a", "#pmap[1]", "#;)"} {
+		func() {
+			defer func() {
+				var se *SyntaxError
+				if err, _ := recover().(error); !errors.As(err, &se) {
+					t.Errorf("For %s, got %v, wanted a SyntaxError", src, err)
+				}
+			}()
+			ParseSource(src, "TestParseSourceAgrees")
+		}()
+	}
+}
@@ -0,0 +1,319 @@
+// o.go: optimizer
+
+package snoc
+
+import (
+	"fmt"
+	"strings"
+)
+
+const InlineMaxSize = 16 // Max nodes in a DEFUN body to be inlined.
+const InlineMaxDepth = 4 // Max nesting of inlining within inlining.
+
+// Guard methods.
+
+func (o *Guard) Choose(globals map[*Sym]Any) Any {
+	for i, sym := range o.Syms {
+		if globals[sym] != o.Wants[i] {
+			return o.Slow
+		}
+	}
+	return o.Fast
+}
+
+func (o *Guard) String() string {
+	return DumpString(o)
+}
+
+// OptimizeProto optimizes the body (and let values) of a ProtoFunc in place.
+func OptimizeProto(terp *Terp, pf *ProtoFunc) {
+	optimizeProto(terp, pf, 0)
+}
+
+// Optimize returns an optimized version of the form x,
+// which may be a raw top-level form or a preprocessed body.
+// Wherever it depends on a global binding, the result is a *Guard
+// that falls back to the unoptimized form if the binding changes.
+func Optimize(terp *Terp, x Any) Any {
+	return optimize(terp, x, 0)
+}
+
+func optimizeProto(terp *Terp, pf *ProtoFunc, depth int) {
+	for i, v := range pf.Values {
+		pf.Values[i] = optimize(terp, v, depth)
+	}
+	pf.Body = optimize(terp, pf.Body, depth)
+}
+
+func optimize(terp *Terp, x Any, depth int) Any {
+	t, ok := x.(*Pair)
+	if !ok {
+		switch u := x.(type) {
+		case *ProtoFunc:
+			optimizeProto(terp, u, depth)
+		case *Guard:
+			return guarded(u.Syms, u.Wants, optimize(terp, u.Fast, depth), u.Slow)
+		}
+		return x
+	}
+	if t == NIL {
+		return NIL
+	}
+
+	sym, _ := t.H.(*Sym)
+	var global Any
+	if sym != nil {
+		global = terp.Globals[sym]
+	}
+
+	switch g := global.(type) {
+	case *Special:
+		switch g.Name {
+		case "if":
+			return optimizeIf(terp, t, sym, g, depth)
+		case "and", "or", "all", "any":
+			return &Pair{H: t.H, T: optimizeArgs(terp, t.T, depth)}
+		}
+		return x // Other specials may not evaluate their args.
+	}
+
+	args := ListToVec(optimizeArgs(terp, t.T, depth))
+	slow := &Pair{H: optimize(terp, t.H, depth), T: VecToList(args).(*Pair)}
+
+	switch g := global.(type) {
+	case *Prim:
+		if g.Pure {
+			if z, ok := fold(g, sym, args, slow); ok {
+				return z
+			}
+		}
+	case *ProtoFunc:
+		// Only inline functions of this namespace, since the body's
+		// globals mean something else in another one.
+		if depth < InlineMaxDepth && g.NS == terp.NS && inlinable(g, sym, args) {
+			syms, wants, fasts := unguardAll(args)
+			body := substitute(g.Body, g, fasts)
+			fast := optimize(terp, body, depth+1)
+			return guarded(append(syms, sym), append(wants, g), fast, slow)
+		}
+	}
+	return slow
+}
+
+func optimizeArgs(terp *Terp, p *Pair, depth int) *Pair {
+	vec := ListToVec(p)
+	for i, e := range vec {
+		vec[i] = optimize(terp, e, depth)
+	}
+	return VecToList(vec).(*Pair)
+}
+
+// optimizeIf drops clauses whose predicates are constant.
+func optimizeIf(terp *Terp, t *Pair, sym *Sym, g *Special, depth int) Any {
+	args := ListToVec(optimizeArgs(terp, t.T, depth))
+	slow := &Pair{H: t.H, T: VecToList(args).(*Pair)}
+
+	syms, wants := []*Sym{sym}, []Any{g}
+	var kept []Any
+	changed := false
+	for len(args) >= 2 {
+		predSyms, predWants, pred := unguard(args[0])
+		if !IsConstant(pred) {
+			kept = append(kept, args[0], args[1])
+			args = args[2:]
+			continue
+		}
+		changed = true
+		syms, wants = append(syms, predSyms...), append(wants, predWants...)
+		if Bool(pred) {
+			args = args[1:2] // This clause becomes the else.
+			break
+		}
+		args = args[2:] // Drop the dead clause.
+	}
+	if !changed || len(args) != 1 {
+		return slow
+	}
+
+	var fast Any
+	if len(kept) == 0 {
+		fast = args[0]
+	} else {
+		fast = &Pair{H: t.H, T: VecToList(append(kept, args[0])).(*Pair)}
+	}
+	return guarded(syms, wants, fast, slow)
+}
+
+// fold calls a pure prim at optimization time, if all args are constant.
+func fold(g *Prim, sym *Sym, args []Any, slow Any) (z Any, ok bool) {
+	syms, wants, fasts := unguardAll(args)
+	for _, e := range fasts {
+		if !IsConstant(e) {
+			return nil, false
+		}
+	}
+	defer func() {
+		if r := recover(); r != nil {
+			z, ok = nil, false // Leave it for runtime to complain.
+		}
+	}()
+	value := g.F(fasts, nil)
+	if value == TRUE {
+		// TRUE is a symbol, so it evaluates through the Globals too.
+		syms, wants = append(syms, TRUE), append(wants, TRUE)
+	}
+	return guarded(append(syms, sym), append(wants, g), value, slow), true
+}
+
+// guarded makes a Guard, absorbing the conditions of a Guard in fast,
+// since Slow is correct whenever any of them fails.
+func guarded(syms []*Sym, wants []Any, fast Any, slow Any) *Guard {
+	if g, ok := fast.(*Guard); ok {
+		syms, wants, fast = append(syms, g.Syms...), append(wants, g.Wants...), g.Fast
+	}
+	return &Guard{Syms: syms, Wants: wants, Fast: fast, Slow: slow}
+}
+
+// unguard returns the constant Fast of a Guard and what it depends on.
+func unguard(x Any) ([]*Sym, []Any, Any) {
+	if g, ok := x.(*Guard); ok && IsConstant(g.Fast) {
+		return g.Syms, g.Wants, g.Fast
+	}
+	if x == TRUE {
+		// TRUE is a symbol, so it is constant only while its global is.
+		return []*Sym{TRUE}, []Any{TRUE}, x
+	}
+	return nil, nil, x
+}
+
+func unguardAll(args []Any) (syms []*Sym, wants []Any, fasts []Any) {
+	fasts = make([]Any, len(args))
+	for i, e := range args {
+		s, w, f := unguard(e)
+		syms, wants, fasts[i] = append(syms, s...), append(wants, w...), f
+	}
+	return
+}
+
+func IsConstant(x Any) bool {
+	switch x.(type) {
+	case float64, int, string, *Keyword:
+		return true
+	}
+	return x == NIL || x == TRUE
+}
+
+// inlinable requires a small non-recursive body without nested functions,
+// and args that are cheap and side-effect free, so they can be duplicated.
+func inlinable(pf *ProtoFunc, sym *Sym, args []Any) bool {
+	if pf.IsLet || len(args) != len(pf.Params) {
+		return false
+	}
+	for _, e := range args {
+		_, _, f := unguard(e)
+		switch f.(type) {
+		case *Var, *Sym:
+			continue
+		}
+		if !IsConstant(f) {
+			return false
+		}
+	}
+	size := 0
+	ok := true
+	var walk func(x Any)
+	walk = func(x Any) {
+		size++
+		switch t := x.(type) {
+		case *ProtoFunc:
+			ok = false
+		case *Sym:
+			if t == sym {
+				ok = false
+			}
+		case *Guard:
+			walk(t.Fast)
+			walk(t.Slow)
+		case *Pair:
+			for p := t; p != NIL; p = p.T {
+				walk(p.H)
+			}
+		}
+	}
+	walk(pf.Body)
+	return ok && size <= InlineMaxSize
+}
+
+// substitute replaces Vars of pf with the given args.
+func substitute(x Any, pf *ProtoFunc, args []Any) Any {
+	switch t := x.(type) {
+	case *Var:
+		if t.Proto == pf {
+			return args[t.Slot]
+		}
+	case *Guard:
+		return &Guard{
+			Syms:  t.Syms,
+			Wants: t.Wants,
+			Fast:  substitute(t.Fast, pf, args),
+			Slow:  substitute(t.Slow, pf, args),
+		}
+	case *Pair:
+		if t == NIL {
+			return NIL
+		}
+		return &Pair{
+			H: substitute(t.H, pf, args),
+			T: substitute(t.T, pf, args).(*Pair),
+		}
+	}
+	return x
+}
+
+// DumpString shows an optimized form, with Vars by name
+// and Guards as (guard (syms...) fast slow).
+func DumpString(x Any) string {
+	var buf strings.Builder
+	dump(&buf, x)
+	return buf.String()
+}
+
+func dump(buf *strings.Builder, x Any) {
+	switch t := x.(type) {
+	case *Var:
+		buf.WriteString(t.Sym.S)
+	case *Guard:
+		buf.WriteString("(guard (")
+		for i, sym := range t.Syms {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			buf.WriteString(sym.S)
+		}
+		buf.WriteString(") ")
+		dump(buf, t.Fast)
+		buf.WriteByte(' ')
+		dump(buf, t.Slow)
+		buf.WriteByte(')')
+	case *ProtoFunc:
+		fmt.Fprintf(buf, "(fn %s %v ", t.Name, t.Params)
+		for i, v := range t.Values {
+			fmt.Fprintf(buf, "%s=", t.Params[i].S)
+			dump(buf, v)
+			buf.WriteByte(' ')
+		}
+		dump(buf, t.Body)
+		buf.WriteByte(')')
+	case *Pair:
+		buf.WriteByte('(')
+		for p := t; p != NIL; p = p.T {
+			if p != t {
+				buf.WriteByte(' ')
+			}
+			dump(buf, p.H)
+		}
+		buf.WriteByte(')')
+	default:
+		buf.WriteString(Stringify(x))
+	}
+}
@@ -0,0 +1,104 @@
+package snoc
+
+import (
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestOptimizeFold(t *testing.T) {
+	terp := NewTerp()
+	env := &Env{Terp: terp}
+	x := Optimize(terp, ParseText("(+ 1 (* 2 3))", "TestOptimizeFold")[0])
+	g, ok := x.(*Guard)
+	if !ok || g.Fast != 7.0 {
+		t.Fatalf("Got %s, wanted a guarded 7", DumpString(x))
+	}
+	if got := Eval(x, env); got != 7.0 {
+		t.Errorf("Got %v, wanted 7", got)
+	}
+
+	// Redefining + must defeat the folded constant.
+	terp.Globals[Intern("+")] = terp.Globals[Intern("-")]
+	if got := Eval(x, env); got != -5.0 {
+		t.Errorf("After redefining +, got %v, wanted -5", got)
+	}
+}
+
+func TestOptimizeIf(t *testing.T) {
+	terp := NewTerp()
+	x := Optimize(terp, ParseText("(if (< 2 1) (head 1) (> 2 1) 100 200)", "TestOptimizeIf")[0])
+	g, ok := x.(*Guard)
+	if !ok || g.Fast != 100.0 {
+		t.Fatalf("Got %s, wanted a guarded 100", DumpString(x))
+	}
+}
+
+// TestOptimizeTrue checks that folding the symbol true is guarded,
+// so redefining it acts the same with and without the optimizer.
+func TestOptimizeTrue(t *testing.T) {
+	for _, opt := range []bool{false, true} {
+		terp := NewTerp()
+		terp.Optimize = opt
+		results := Repl(terp, strings.NewReader(`
+			(defun f (x) (if true 1 2))
+			(defun g (x) (list (eq true nil) (+ 1 2)))
+			(list (f 3) (g 3))
+			(def true nil)
+			(list (f 3) (g 3))
+		`))
+		if got := Stringify(results[2]); got != "(1 (() 3))" {
+			t.Errorf("With optimize %v, got %s", opt, got)
+		}
+		if got := Stringify(results[4]); got != "(2 (true 3))" {
+			t.Errorf("With optimize %v, after redefining true, got %s", opt, got)
+		}
+	}
+}
+
+func TestOptimizeInline(t *testing.T) {
+	var dump strings.Builder
+	terp := NewTerp()
+	terp.Optimize = true
+	terp.OptDump = &dump
+	results := Repl(terp, strings.NewReader(`
+		(defun sq (x) (* x x))
+		(defun sq-plus-one (y) (+ (sq y) 1))
+		(sq-plus-one 5)
+	`))
+	if got := results[len(results)-1]; got != 26.0 {
+		t.Errorf("Got %v, wanted 26", got)
+	}
+	if !strings.Contains(dump.String(), "(guard (sq-plus-one sq * +) 26 ") {
+		t.Errorf("Expected inlined and folded guard in dump: %s", dump.String())
+	}
+}
+
+func TestOptimizeModules(t *testing.T) {
+	dir := t.TempDir()
+	geom := `(module geom (export area area-of-two))
+		(defun sq (x) (* x x))
+		(defun area (r) (* 3 (sq r)))
+		(defun area-of-two () (area 2))`
+	if err := ioutil.WriteFile(filepath.Join(dir, "geom.snoc"), []byte(geom), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	var dump strings.Builder
+	terp := NewTerp()
+	terp.Optimize = true
+	terp.OptDump = &dump
+	terp.Path = []string{dir}
+	results := Repl(terp, strings.NewReader(`
+		(require geom)
+		(defun f (r) (area r))
+		(list (f 2) (area-of-two))
+	`))
+	if got := Stringify(results[len(results)-1]); got != "(12 12)" {
+		t.Errorf("Got %s, wanted (12 12)", got)
+	}
+	if !strings.Contains(dump.String(), "(guard (area sq * *) 12 ") {
+		t.Errorf("Expected inlining within the module in dump: %s", dump.String())
+	}
+}
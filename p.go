@@ -2,37 +2,18 @@ package snoc
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
 	"log"
+	"sort"
 	"strconv"
 	"strings"
 	"text/scanner"
 )
 
-type Tok struct {
-	Pos  scanner.Position
-	Text string
-}
-
-func Lex(text, filename string) (z []Tok) {
-	var s scanner.Scanner
-	s.Init(strings.NewReader(text))
-	s.Filename = filename
-	s.Mode = scanner.ScanIdents | scanner.ScanStrings | scanner.ScanRawStrings | scanner.ScanComments | scanner.SkipComments
-	s.IsIdentRune = func(ch rune, i int) bool {
-		return ch != '(' && ch != ')' && (ch != '/' || i > 0) && ch > ' '
-	}
-	s.Error = func(_ *scanner.Scanner, msg string) {
-		log.Printf("Lex error at %v: %s", s.Position, msg)
-	}
-	for tok := s.Scan(); tok != scanner.EOF; tok = s.Scan() {
-		//log.Printf("%s: %s\n", s.Position, s.TokenText())
-		z = append(z, Tok{s.Position, s.TokenText()})
-	}
-	if s.ErrorCount > 0 {
-		log.Panicf("Lex found %d errors in %q", s.ErrorCount, filename)
-	}
-	return
+// IsLineComment tells if a comment goes to the end of the line.
+func IsLineComment(text string) bool {
+	return strings.HasPrefix(text, ";") || strings.HasPrefix(text, "//")
 }
 
 func ListLen(a Any) int {
@@ -85,50 +66,131 @@ func VecToList(a []Any) Any {
 	return z
 }
 
-func ParseExprs(toks []Tok) (string, []Tok, []Any) {
-	// me := Serial("###")
-	var z []Any
-	last := ""
-LOOP:
-	for len(toks) > 0 {
-		t, rest := toks[0], toks[1:]
-		switch t.Text {
-		case "(":
-			last2, rest2, vec := ParseExprs(rest)
-			if last2 != ")" {
-				panic(fmt.Errorf("Parens not terminated: last=%q rest=%v", last2, rest2))
+func readAtom(text string) (Any, error) {
+	f, err := strconv.ParseFloat(text, 64)
+	if err == nil {
+		return f, nil
+	} else if strings.HasPrefix(text, `"`) || strings.HasPrefix(text, "`") {
+		str, err := strconv.Unquote(text)
+		if err != nil {
+			return nil, fmt.Errorf("Bad string %s: %v", text, err)
+		}
+		return str, nil
+	} else if strings.HasPrefix(text, `#\`) {
+		c, err := readChar(text)
+		return c, err
+	} else if strings.HasPrefix(text, "#<") {
+		return nil, fmt.Errorf("Cannot read unreadable object %q", text)
+	} else if strings.HasPrefix(text, "|") {
+		return Intern(UnbarSym(text)), nil
+	} else if strings.HasPrefix(text, ":|") {
+		return InternKeyword(UnbarSym(text[1:])), nil
+	} else if len(text) > 1 && text[0] == ':' {
+		return InternKeyword(text[1:]), nil
+	} else if text == "nil" {
+		return NIL, nil
+	}
+	return Intern(text), nil
+}
+
+// A Tok is a token of source text at Pos.
+type Tok struct {
+	Pos  scanner.Position
+	Text string
+}
+
+// Lex splits text into tokens, dropping comments.
+// It panics with a *SyntaxError on a bad token.
+//
+// Deprecated: Use a Reader, which reads whole forms.
+func Lex(text, filename string) (z []Tok) {
+	rd := NewReader(strings.NewReader(text), filename)
+	defer func() {
+		if r := recover(); r != nil {
+			if f, ok := r.(readFailure); ok {
+				panic(f.err)
 			}
-			toks = rest2
-			z = append(z, VecToList(vec))
-		case ")":
-			toks = rest
-			last = ")"
-			break LOOP
-		default:
-			f, err := strconv.ParseFloat(t.Text, 64)
-			if err == nil {
-				z = append(z, f)
-			} else if t.Text == "nil" {
-				z = append(z, NIL)
-			} else {
-				z = append(z, Intern(t.Text))
+			panic(r)
+		}
+	}()
+	for {
+		kind, text, pos := rd.token()
+		switch kind {
+		case tokEOF:
+			return z
+		case tokComment:
+			continue
+		}
+		z = append(z, Tok{pos, text})
+	}
+}
+
+// ParseExprs reads forms from toks, up to a closing bracket that does not
+// match, which it returns as last, with the tokens after it as rest.
+// It panics with a *SyntaxError on a mistake.
+//
+// Deprecated: Use a Reader.
+func ParseExprs(toks []Tok) (last string, rest []Tok, z []Any) {
+	var buf strings.Builder
+	ends := make([]int, len(toks)) // Offset just after each token.
+	for i, t := range toks {
+		buf.WriteString(t.Text)
+		buf.WriteByte(' ')
+		ends[i] = buf.Len()
+	}
+	// tok is the index of the token at offset.
+	tok := func(offset int) int {
+		return sort.SearchInts(ends, offset+1)
+	}
+	rd := NewReader(strings.NewReader(buf.String()), "")
+	defer func() {
+		if r := recover(); r != nil {
+			f, ok := r.(readFailure)
+			if !ok {
+				panic(r)
 			}
-			toks = rest
+			e := f.err.(*SyntaxError)
+			if i := tok(e.Pos.Offset); i < len(toks) {
+				e.Pos = toks[i].Pos
+			} else if len(toks) > 0 {
+				e.Pos = toks[len(toks)-1].Pos
+			}
+			panic(e)
+		}
+	}()
+	for {
+		x, close := rd.datum()
+		switch close {
+		case 0:
+			z = append(z, x)
+		case eof:
+			return "", nil, z
+		default:
+			return string(close), toks[tok(rd.at.Offset)+1:], z
 		}
 	}
-	return last, toks, z
 }
 
 func ParseText(text, filename string) []Any {
-	toks := Lex(text, filename)
-	last, rest, xs := ParseExprs(toks)
-	if last != "" {
-		log.Panicf("Did not expect nonempty last: last=%q rest=%v", last, rest)
-	}
-	if len(rest) > 0 {
-		log.Panicf("Unused tokens from %q: %v", filename, rest)
+	return ParseTextAt(text, filename, nil)
+}
+
+// ParseTextAt is ParseText, also recording in where the source position
+// of each nonempty list, for error messages.
+func ParseTextAt(text, filename string, where map[*Pair]scanner.Position) []Any {
+	rd := NewReader(strings.NewReader(text), filename)
+	rd.Where = where
+	var z []Any
+	for {
+		x, err := rd.Read()
+		if err == io.EOF {
+			return z
+		}
+		if err != nil {
+			panic(err)
+		}
+		z = append(z, x)
 	}
-	return xs
 }
 
 func ParseFile(filename string) []Any {
@@ -1,6 +1,8 @@
 package snoc
 
 import (
+	"errors"
+	"strings"
 	"testing"
 )
 
@@ -8,3 +10,54 @@ func Test1(t *testing.T) {
 	xs := ParseText("alpha ( beta gamma ) delta", "Test1")
 	t.Logf("XS: %v", xs)
 }
+
+func TestComments(t *testing.T) {
+	src := `(a ; line comment (
+  #| block #| nested |# comment ) |# b
+  #;(c d) #; #; e f g // Go comment
+  /* Go block */ h;i
+)`
+	got := Stringify(ParseText(src, "TestComments")[0])
+	if want := "(a b g h)"; got != want {
+		t.Errorf("Got %s, wanted %s", got, want)
+	}
+}
+
+// TestLex checks the old token API, which wraps the Reader.
+func TestLex(t *testing.T) {
+	toks := Lex("(a \"b c\" ; comment\n  [1 #\\d]) x) y", "TestLex")
+	var texts []string
+	for _, tok := range toks {
+		texts = append(texts, tok.Text)
+	}
+	if got, want := strings.Join(texts, "|"), `(|a|"b c"|[|1|#\d|]|)|x|)|y`; got != want {
+		t.Errorf("Got %s, wanted %s", got, want)
+	}
+	if pos := toks[6].Pos; pos.Line != 2 || pos.Column != 9 {
+		t.Errorf("Got %v for ]", pos)
+	}
+
+	last, rest, xs := ParseExprs(toks)
+	if last != ")" || len(rest) != 1 || rest[0].Text != "y" || Stringify(VecToList(xs)) != `((a b c [1 #\d]) x)` {
+		t.Errorf("Got %q, %v, %v", last, rest, xs)
+	}
+	if _, _, xs := ParseExprs(nil); len(xs) != 0 {
+		t.Errorf("Got %v", xs)
+	}
+	func() {
+		defer func() {
+			e, ok := recover().(*SyntaxError)
+			if !ok || e.Pos.Line != 2 || !errors.Is(e, ErrIncomplete) {
+				t.Errorf("Got %v", e)
+			}
+		}()
+		ParseExprs(Lex("x\n (a (b)", "TestLex"))
+	}()
+
+	if _, ok := TryReplParse("(a [b)"); ok {
+		t.Errorf("TryReplParse accepted (a [b)")
+	}
+	if xs, ok := TryReplParse("a (b)"); !ok || len(xs) != 2 {
+		t.Errorf("TryReplParse got %v, %v", xs, ok)
+	}
+}
@@ -3,18 +3,22 @@
 package snoc
 
 import (
-	"bufio"
+	"errors"
 	"fmt"
 	"io"
 	"log"
 	"os"
 	"runtime/debug"
+	"text/scanner"
 	//"strings"
 
 	. "github.com/strickyak/yak"
 )
 
-func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) (pf *ProtoFunc) {
+// PreprocessFunc makes a ProtoFunc, changing params to Vars in the body.
+// The rewritten lists keep their source positions from where in pf.Where,
+// which nested ProtoFuncs share with their outer one.
+func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc, where map[*Pair]scanner.Position) (pf *ProtoFunc) {
 	Log("PreprocessFunc: %q %v <<< %v <<< %v", name, params, body, outer)
 
 	defer func() {
@@ -31,6 +35,16 @@ func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) (pf
 		Params: params,
 		Body:   nil,
 		Name:   name,
+		Where:  make(map[*Pair]scanner.Position),
+	}
+	if outer != nil {
+		pf.Where = outer.Where
+	}
+	samePlace := func(p, old *Pair) *Pair {
+		if pos, ok := where[old]; ok {
+			pf.Where[p] = pos
+		}
+		return p
 	}
 	var preprocess func(a Any) Any
 	preprocess = func(a Any) Any {
@@ -50,14 +64,38 @@ func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) (pf
 			}
 			Log("preprocess *Sym: >>> SAME")
 			return t // Default: dont change sym.
+		case *Vec:
+			vec := make([]Any, len(t.V))
+			for i, e := range t.V {
+				vec[i] = preprocess(e)
+			}
+			return &Vec{V: vec}
+		case *Hash:
+			h := NewHash(nil)
+			for _, k := range t.Keys {
+				h.Set(preprocess(k), preprocess(t.M[k]))
+			}
+			return h
+		case *PVec:
+			xs := t.ToSlice()
+			for i, e := range xs {
+				xs[i] = preprocess(e)
+			}
+			return pvecConj(EmptyPVec, xs)
+		case *PMap:
+			var kvs []Any
+			t.Each(func(k, v Any) {
+				kvs = append(kvs, preprocess(k), preprocess(v))
+			})
+			return pmapAssoc(EmptyPMap, kvs)
 		case *Pair:
 			if t == NIL {
 				return NIL
 			}
-			log.Printf("ddt: case *Pair: H <<< %v >>> T <<< %v >>>", t.H, t.T)
+			Log("case *Pair: H <<< %v >>> T <<< %v >>>", t.H, t.T)
 			switch t.H {
 			case FN:
-				return PreprocessFunc(Serial("FN_"), ListToVecOfSym(t.T.H), t.T.T.H, pf)
+				return PreprocessFunc(Serial("FN_"), ListToVecOfSym(t.T.H), t.T.T.H, pf, where)
 			case Intern("let"):
 				id2 := Serial("LET_")
 				var params2 []*Sym
@@ -77,21 +115,22 @@ func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) (pf
 					Body:   nil,
 					Name:   id2 + "_LET_",
 					IsLet:  true,
+					Where:  pf.Where,
 				}
 
 				for i, e := range values2 {
 					// pf2.Values[i] = PreprocessFunc(id2+params2[i].S, params2, e, pf2)
-					pf2.Values[i] = PreprocessFunc(id2+params2[i].S, nil, e, pf2)
+					pf2.Values[i] = PreprocessFunc(id2+params2[i].S, nil, e, pf2, where)
 				}
 				// pf2.Body = PreprocessFunc(id2+"_RESULT_", params2, body2, pf2)
-				pf2.Body = PreprocessFunc(id2+"_RESULT_", nil, body2, pf2)
-				return Snoc(NIL, pf2)
+				pf2.Body = PreprocessFunc(id2+"_RESULT_", nil, body2, pf2, where)
+				return samePlace(Snoc(NIL, pf2), t)
 
 			default:
-				return &Pair{
+				return samePlace(&Pair{
 					H: preprocess(t.H),
 					T: preprocess(t.T).(*Pair),
-				}
+				}, t)
 			}
 		}
 		return a
@@ -104,6 +143,9 @@ func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) (pf
 	return pf
 }
 
+// TryReplParse parses s, reporting only whether it could.
+//
+// Deprecated: Use a Reader, whose errors say what is wrong.
 func TryReplParse(s string) (xs []Any, ok bool) {
 	defer func() {
 		r := recover()
@@ -120,83 +162,156 @@ func TryReplEval(terp *Terp, xs []Any) (result Any, err interface{}) {
 	defer func() {
 		r := recover()
 		if r != nil {
-			err = recover()
+			err = terp.ErrorFrom(r)
 			result = err
 		}
 	}()
 
 	result = NIL
-	env := &Env{
-		Terp: terp,
-	}
 	for _, x := range xs {
-		log.Printf("ddt: for")
-		if p, ok := x.(*Pair); ok {
-			if p.H == DEF {
-				vec := ListToVec(p.T)
-				MustEq(len(vec), 2)
-				sym, ok := vec[0].(*Sym)
-				if !ok {
-					Throw(vec[0], "DEF needs symbol at first")
-				}
-				terp.Globals[sym] = vec[1]
-				result = NIL
-				continue
-			} else if p.H == DEFUN {
-				log.Printf("ddt: DEFUN")
-				println(p.H, DEFUN)
-				vec := ListToVec(p.T)
-				log.Printf("ddt: vec: %#v", vec)
-				MustEq(len(vec), 3)
-				sym, ok := vec[0].(*Sym)
-				log.Printf("ddt: sym: %v %v", sym, ok)
-				if !ok {
-					Throw(vec[0], "DEFUN needs symbol at first")
-				}
-				// func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) *ProtoFunc
-				proto := PreprocessFunc(sym.S, ListToVecOfSym(vec[1]), vec[2], nil)
-				log.Printf("ddt: DEFUN sym %v proto %v", sym, proto)
-				// defun := Snoc(Snoc(Snoc(NIL, vec[2]), vec[1]), FN)
-				terp.Globals[sym] = proto
-				result = NIL
-				continue
+		terp.Used = Usage{}
+		result = EvalTop(terp, x)
+	}
+	return result, nil
+}
+
+// EvalTop evaluates a top-level form, such as from the REPL or a file,
+// where def and defun define globals in terp.Globals.
+func EvalTop(terp *Terp, x Any) Any {
+	defer terp.forget(x)
+	Log("for")
+	if p, ok := x.(*Pair); ok {
+		if p.H == DEF {
+			vec := ListToVec(p.T)
+			MustEq(len(vec), 2)
+			sym, ok := vec[0].(*Sym)
+			if !ok {
+				Throw(vec[0], "DEF needs symbol at first")
+			}
+			terp.Globals[sym] = vec[1]
+			return NIL
+		} else if p.H == DEFUN {
+			Log("DEFUN")
+			vec := ListToVec(p.T)
+			Log("vec: %#v", vec)
+			MustEq(len(vec), 3)
+			sym, ok := vec[0].(*Sym)
+			Log("sym: %v %v", sym, ok)
+			if !ok {
+				Throw(vec[0], "DEFUN needs symbol at first")
 			}
+			// func PreprocessFunc(name string, params []*Sym, body Any, outer *ProtoFunc) *ProtoFunc
+			proto := PreprocessFunc(sym.S, ListToVecOfSym(vec[1]), vec[2], nil, terp.Where)
+			proto.NS = terp.NS
+			Log("DEFUN sym %v proto %v", sym, proto)
+			if terp.Optimize {
+				OptimizeProto(terp, proto)
+			}
+			if terp.OptDump != nil {
+				fmt.Fprintf(terp.OptDump, "(defun %s %v %s)\n", sym.S, vec[1], DumpString(proto.Body))
+			}
+			// defun := Snoc(Snoc(Snoc(NIL, vec[2]), vec[1]), FN)
+			terp.Globals[sym] = proto
+			return NIL
 		}
-		result = Eval(x, env)
 	}
-	return result, nil
+	if terp.Optimize {
+		x = Optimize(terp, x)
+	}
+	if terp.OptDump != nil {
+		fmt.Fprintf(terp.OptDump, "%s\n", DumpString(x))
+	}
+	return Eval(x, &Env{Terp: terp})
+}
+
+// forget drops the positions of the lists in a top-level form when it is done,
+// so terp.Where does not grow; defuns keep theirs in their ProtoFunc.
+// An error is placed first, while the positions are known.
+func (terp *Terp) forget(x Any) {
+	r := recover()
+	if r != nil {
+		stack := terp.Stack
+		r = terp.ErrorFrom(r)
+		terp.Stack = stack
+	}
+	var walk func(x Any)
+	walk = func(x Any) {
+		switch t := x.(type) {
+		case *Pair:
+			for p := t; p != NIL; p = p.T {
+				delete(terp.Where, p)
+				walk(p.H)
+			}
+		case *Vec:
+			for _, e := range t.V {
+				walk(e)
+			}
+		case *Hash:
+			for _, k := range t.Keys {
+				walk(k)
+				walk(t.M[k])
+			}
+		case *PVec:
+			for _, e := range t.ToSlice() {
+				walk(e)
+			}
+		case *PMap:
+			t.Each(func(k, v Any) {
+				walk(k)
+				walk(v)
+			})
+		}
+	}
+	walk(x)
+	if r != nil {
+		panic(r)
+	}
 }
 
 func Repl(terp *Terp, r io.Reader) []Any {
-	sc := bufio.NewScanner(r)
+	return ReplFile(terp, r, "*repl*")
+}
+
+// ReplFile is Repl, naming the filename in error messages.
+func ReplFile(terp *Terp, r io.Reader, filename string) []Any {
+	rd := NewReader(r, filename)
+	rd.Where = terp.Where
+	rd.GoComments = terp.GoComments
 	var results []Any
-	buf := ""
-	for sc.Scan() {
-		//L("TEXT: %q", sc.Text())
-		buf += sc.Text() + "\n"
-		//L("TRY: %q", buf)
-		xs, ok := TryReplParse(buf)
-		if !ok {
-			continue
+	for {
+		x, err := rd.Read()
+		if err == io.EOF {
+			break
 		}
-		buf = ""
-		if len(xs) == 0 {
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+			results = append(results, fmt.Sprintf("*ERROR* %v", err))
+			if errors.Is(err, ErrIncomplete) {
+				break
+			}
 			continue
 		}
 
-		for i, x := range xs {
-			fmt.Fprintf(os.Stderr, "[%d]<---- %v\n", i, x)
-		}
-		result, err := TryReplEval(terp, xs)
-		if err != nil {
-			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
-			errStr := fmt.Sprintf("*ERROR* %v", err)
-			// results = append(results, Snoc(Snoc(NIL, errStr), Intern("*ERROR*")))
-			results = append(results, errStr)
+		fmt.Fprintf(os.Stderr, "<---- %v\n", x)
+		result, evalErr := TryReplEval(terp, []Any{x})
+		if evalErr != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", evalErr)
+			results = append(results, fmt.Sprintf("*ERROR* %v", evalErr))
 		} else {
-			fmt.Fprintf(os.Stderr, "---->   %v\n", result)
+			fmt.Fprintf(os.Stderr, "---->   %s\n", showResult(result))
 			results = append(results, result)
 		}
 	}
 	return results
 }
+
+// showResult lays out a REPL result, or says why it cannot,
+// as when it contains itself.
+func showResult(x Any) (s string) {
+	defer func() {
+		if r := recover(); r != nil {
+			s = fmt.Sprintf("*ERROR* %v", r)
+		}
+	}()
+	return PPNode(ToNode(x), 8, DefaultWidth)
+}
@@ -1,6 +1,7 @@
 package snoc
 
 import (
+	"errors"
 	"strings"
 	"testing"
 )
@@ -18,6 +19,99 @@ func TestPrograms(t *testing.T) {
 			(list (+ 3 4) (quote (+ 3 9)) (quote xyzzy))
 		`, "(7 (+ 3 9) xyzzy)"},
 
+		{`
+			(list (1st (list 1 2 3 4 5)) (3rd (list 1 2 3 4 5)) (5th (list 1 2 3 4 5)))
+		`, "(1 3 5)"},
+
+		{`
+			(list (vector-ref [10 20 30] 1) (vector-length (vector)) (vector->list [(+ 1 2) 4]))
+		`, "(20 0 (3 4))"},
+
+		{`
+			(defun double-all (v) (vector-map (fn (x) (* 2 x)) v))
+			(defun demo () (let
+			     v (list->vector (list 1 2 3 4))
+			     w (double-all v)
+			     (list (vector-set! v 0 99) v (vector-slice w 1 3))))
+			(demo)
+		`, "(99 [99 2 3 4] [4 6])"},
+
+		{`
+			(defun demo () (let
+			     h {(quote a) 1 (quote b) (+ 1 1)}
+			     x (hash-set! h 3 (quote three))
+			     y (hash-remove! h (quote a))
+			     (list h (hash-ref h (quote b)) (hash-ref h (quote a) 404) (hash-count h) (hash-keys h))))
+			(demo)
+		`, "({b 2 3 three} 2 404 2 (b 3))"},
+
+		{`
+			(defun demo () (let
+			     m1 (pmap 1 (quote one))
+			     m2 (pmap-assoc m1 2 (quote two))
+			     v1 (pvec 1 2)
+			     v2 (pvec-conj (pvec-assoc v1 0 (quote x)) 3)
+			     (list (pmap-count m1) (pmap-get m2 2) (pmap-get (pmap-dissoc m2 1) 1 404) v1 v2 (pvec-nth v2 2))))
+			(demo)
+		`, "(1 two 404 #pvec[1 2] #pvec[x 2 3] 3)"},
+
+		{`
+			(defstruct point x y)
+			(defun demo () (let
+			     p (make-point 1 2)
+			     q (make-point 1 2)
+			     old (set-point-y! q 3)
+			     (list p (point-x q) (point-y q) (point? p) (point? 5) (eq p p) (eq p q))))
+			(demo)
+		`, "(#<point x=1 y=2> 1 3 true () true ())"},
+
+		{`
+			(list (eq (list 1 2) (list 1 2)) (equal? (list 1 [2 3]) (list 1 [2 3])) (equal? 1 2)
+			      (compare 1 2) (compare (list 1 2) (list 1)) (== (hash [1 2]) (hash (vector 1 2))))
+		`, "(() true () -1 1 true)"},
+
+		{`
+			(list (string-length "héllo") (string-ref "héllo" 1) (substring "héllo" 1 3)
+			      (string-append "a b" "(c)") (string->list "añ") (list->string (list #\x41 #\( #\λ)))
+		`, "(5 #\\é él a b(c) (#\\a #\\ñ) A(λ)"},
+
+		{`
+			(list (char->integer #\A) (integer->char 955) (char-upcase #\ä) (char-alphabetic? #\3)
+			      #\space #\( (eq #\a #\a) (string-upcase "héllo"))
+		`, "(65 #\\λ #\\Ä () #\\space #\\( true HÉLLO)"},
+
+		{`
+			(list :size (keyword? :size) (keyword? (quote size)) (eq :a (string->keyword "a"))
+			      (keyword->string :a) (symbol->keyword (quote b)) (plist-get (list :a 1 :b 2) :b)
+			      (hash-ref {:x 10} :x))
+		`, "(:size true () true a :b 2 10)"},
+
+		{`
+			(defun demo () (list
+			     (map (fn (x) (* x x)) (range 4))
+			     (filter (fn (x) (< x 2)) (list 3 1 0 5))
+			     (reduce (fn (acc x) (cons x acc)) (list) (list 1 2 3))
+			     (sort (list 3 1 2) (fn (a b) (> a b)))))
+			(demo)
+		`, "((0 1 4 9) (1 0) (3 2 1) (3 2 1))"},
+
+		{`
+			(list (append (list 1 2) (list) (list 3)) (reverse (list 1 2 3)) (length (list 1 2))
+			      (nth (list 7 8 9) 2) (last (list 1 2)) (range 5 0 -2) (sort (list "b" 3 "a" 1)))
+		`, "((1 2 3) (3 2 1) 2 9 2 (5 3 1) (1 3 a b))"},
+
+		{`
+			(list (assoc 2 (list (list 1 (quote a)) (list 2 (quote b)))) (assoc 3 (list))
+			      (member [2] (list 1 [2] 3)) (zip (list 1 2 3) (list 4 5))
+			      (flatten (list 1 (list 2 (list 3 4)) (list) 5))
+			      (take 2 (range 5)) (drop 3 (range 5)) (take 9 (list 1)) (drop 9 (list 1)))
+		`, "((2 b) () ([2] 3) ((1 4) (2 5)) (1 2 3 4 5) (0 1) (3 4) (1) ())"},
+
+		{`
+			(defun map (f xs) (quote mine))
+			(list (map 1 2) (core/map 1st (list (list 1) (list 2))) (flatten (list (list 1))))
+		`, "(mine (1 2) (1))"},
+
 		{`(defun foo() (let
 			    A (list 1 2 3)
 					B (list 4 5 6)
@@ -124,3 +218,98 @@ func TestPrograms(t *testing.T) {
 
 	}
 }
+
+func TestOutput(t *testing.T) {
+	var out strings.Builder
+	terp := NewTerp()
+	terp.Out = &out
+	Repl(terp, strings.NewReader(`
+		(display (list "a b" #\c 1.5))
+		(newline)
+		(write (list "a b" #\c 1.5))
+		(newline)
+		(format "~a and ~s make ~d~%~~~%" "x" "y" (+ 1 1))
+		(print [1 "two"])
+	`))
+	want := "(a b c 1.5)\n(\"a b\" #\\c 1.5)\nx and \"y\" make 2\n~\n[1 \"two\"]\n"
+	if got := out.String(); got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+}
+
+// TestOutputErrors checks that a bad format writes nothing.
+func TestOutputErrors(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(format "~a and ~a" 1)`, `*ERROR* *repl*:1:1: format: not enough args "~a and ~a"`},
+		{`(format "~a" 1 2)`, `*ERROR* *repl*:1:1: format: too many args (2)`},
+		{`(format "~q" 1)`, `*ERROR* *repl*:1:1: format: unknown directive ~q "~q"`},
+		{`(format "50~")`, `*ERROR* *repl*:1:1: format: ends with ~ "50~"`},
+		{`(format "~d" "x")`, `*ERROR* *repl*:1:1: cannot Float "x"`},
+		{`(format 5)`, `*ERROR* *repl*:1:1: cannot Str 5`},
+		{`(newline 1)`, `*ERROR* *repl*:1:1: MustLen failed: len 1 != 0`},
+		{`(display)`, `*ERROR* *repl*:1:1: MustLen failed: len 0 != 1`},
+		{`(format "")`, `()`},
+	}
+	for _, sc := range scenarios {
+		var out strings.Builder
+		terp := NewTerp()
+		terp.Out = &out
+		results := Repl(terp, strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+		if out.Len() != 0 {
+			t.Errorf("For %s, got output %q", sc.program, out.String())
+		}
+	}
+
+	terp := NewTerp()
+	terp.Out = failingWriter{}
+	results := Repl(terp, strings.NewReader(`(display "x")`))
+	if got := Stringify(results[0]); got != `*ERROR* *repl*:1:1: cannot write output: disk full "x"` {
+		t.Errorf("Got %s", got)
+	}
+}
+
+type failingWriter struct{}
+
+func (failingWriter) Write(p []byte) (int, error) {
+	return 0, errors.New("disk full")
+}
+
+// TestListPrims checks the edge cases of the list functions.
+func TestListPrims(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(range 0 1 0.1)`, "(0 0.1 0.2 0.30000000000000004 0.4 0.5 0.6000000000000001 0.7000000000000001 0.8 0.9)"},
+		{`(length (range 0 1 0.1))`, "10"},
+		{`(range 1 0 0.25)`, "()"},
+		{`(range 0 -1 -0.25)`, "(0 -0.25 -0.5 -0.75)"},
+		{`(range 3 3)`, "()"},
+		{`(range -2)`, "()"},
+		{`(range 0 5 0)`, "*ERROR* *repl*:1:1: range step cannot be zero: (0 5 0)"},
+		{`(range 0 1e300 1)`, "*ERROR* *repl*:1:1: range is too long: (0 1e+300 1)"},
+		{`(range)`, "*ERROR* *repl*:1:1: range wants 1 to 3 args, but got ()"},
+		{`(take 5 (list 1 2))`, "(1 2)"},
+		{`(take -1 (list 1 2))`, "()"},
+		{`(drop 5 (list 1 2))`, "()"},
+		{`(drop 0 (list 1 2))`, "(1 2)"},
+		{`(take 1 nil)`, "()"},
+		{`(nth (list 7 8 9) 0)`, "7"},
+		{`(nth (list 7 8 9) 3)`, "*ERROR* *repl*:1:1: index out of range [0, 3) 3"},
+		{`(nth (list 7 8 9) -1)`, "*ERROR* *repl*:1:1: index out of range [0, 3) -1"},
+		{`(nth nil 0)`, "*ERROR* *repl*:1:1: index out of range [0, 0) 0"},
+		{`(last nil)`, "*ERROR* *repl*:1:1: cannot Last ()"},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
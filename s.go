@@ -0,0 +1,85 @@
+// s.go: structs (records)
+
+package snoc
+
+import (
+	"fmt"
+	"strings"
+
+	. "github.com/strickyak/yak"
+)
+
+var BuiltinRecordSpecials = map[string]func([]Any, *Env) Any{
+	// (defstruct point x y) defines make-point, point?,
+	// point-x, point-y, set-point-x!, and set-point-y!.
+	"defstruct": func(args []Any, env *Env) Any {
+		Must(len(args) >= 1)
+		name, ok := args[0].(*Sym)
+		if !ok {
+			Throw(args[0], "defstruct needs symbol for name")
+		}
+		st := &StructType{Name: name.S}
+		for _, a := range args[1:] {
+			field, ok := a.(*Sym)
+			if !ok {
+				Throw(a, "defstruct needs symbols for fields")
+			}
+			st.Fields = append(st.Fields, field)
+		}
+		DefineStruct(env.Namespace().Globals, st)
+		return NIL
+	},
+}
+
+// DefineStruct defines the constructor, predicate, accessors, and setters.
+func DefineStruct(globals map[*Sym]Any, st *StructType) {
+	define := func(name string, fn func(args []Any, env *Env) Any) {
+		globals[Intern(name)] = &Prim{Name: name, F: fn}
+	}
+
+	define("make-"+st.Name, func(args []Any, env *Env) Any {
+		if len(args) != len(st.Fields) {
+			Throw(VecToList(args), "make-%s: got %d args but wanted %d", st.Name, len(args), len(st.Fields))
+		}
+		return &Record{Type: st, Vals: append([]Any(nil), args...)}
+	})
+	define(st.Name+"?", func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		r, ok := args[0].(*Record)
+		return LispyBool(ok && r.Type == st)
+	})
+	for i, field := range st.Fields {
+		i, field := i, field // Capture an inside-loop copy.
+		define(st.Name+"-"+field.S, func(args []Any, env *Env) Any {
+			MustLen(args, 1)
+			return ToRecord(args[0], st).Vals[i]
+		})
+		define("set-"+st.Name+"-"+field.S+"!", func(args []Any, env *Env) Any {
+			MustLen(args, 2)
+			ToRecord(args[0], st).Vals[i] = args[1]
+			return args[1]
+		})
+	}
+}
+
+func ToRecord(o Any, st *StructType) *Record {
+	if r, ok := o.(*Record); ok && r.Type == st {
+		return r
+	}
+	Throw(o, "cannot Record %s", st.Name)
+	return nil
+}
+
+func (o *Record) String() string {
+	return o.stringAt(0)
+}
+
+func (o *Record) stringAt(depth int) string {
+	var buf strings.Builder
+	fmt.Fprintf(&buf, "#<%s", o.Type.Name)
+	for i, field := range o.Type.Fields {
+		fmt.Fprintf(&buf, " %s=%s", field.S, stringify(o.Vals[i], depth+1))
+	}
+	buf.WriteString(">")
+	return buf.String()
+}
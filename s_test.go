@@ -0,0 +1,32 @@
+package snoc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestRecordEdges(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(defstruct point x y) (make-point 1)`, "*ERROR* *repl*:1:23: make-point: got 1 args but wanted 2 (1)"},
+		{`(defstruct point x y) (make-point 1 2 3)`, "*ERROR* *repl*:1:23: make-point: got 3 args but wanted 2 (1 2 3)"},
+		{`(defstruct point x y) (point-x 5)`, "*ERROR* *repl*:1:23: cannot Record point 5"},
+		{`(defstruct point x y) (defstruct size x y) (point-x (make-size 1 2))`, "*ERROR* *repl*:1:44: cannot Record point #<size x=1 y=2>"},
+		{`(defstruct point x y) (set-point-y! (vector 1 2) 3)`, "*ERROR* *repl*:1:23: cannot Record point [1 2]"},
+		{`(defstruct point x y) (point?)`, "*ERROR* *repl*:1:23: MustLen failed: len 0 != 1"},
+		{`(defstruct empty) (list (make-empty) (empty? (make-empty)))`, "(#<empty> true)"},
+		{`(defstruct point x y) (equal? (make-point 1 2) (make-point 1 2))`, "true"},
+		{`(defstruct point x y) (equal? (make-point 1 2) (make-point 1 3))`, "()"},
+		{`(defstruct point x y) (defstruct size x y) (equal? (make-point 1 2) (make-size 1 2))`, "()"},
+		{`(defstruct 5 x)`, "*ERROR* *repl*:1:1: defstruct needs symbol for name 5"},
+		{`(defstruct point x "y")`, "*ERROR* *repl*:1:1: defstruct needs symbols for fields \"y\""},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
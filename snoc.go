@@ -3,8 +3,12 @@
 package main
 
 import (
+	"bytes"
 	"flag"
+	"fmt"
+	"io/ioutil"
 	"os"
+	"os/exec"
 
 	. "github.com/strickyak/go-snoc"
 	. "github.com/strickyak/yak"
@@ -12,9 +16,100 @@ import (
 
 func main() {
 	flag.Parse()
+	args := flag.Args()
+	if len(args) > 0 && args[0] == "fmt" {
+		os.Exit(fmtMain(args[1:]))
+	}
+
+	terp := NewTerp()
+	if len(args) > 0 && args[0] != "opt" {
+		// snoc file.snoc... runs the files.
+		for _, filename := range args {
+			r, err := os.Open(filename)
+			if err != nil {
+				fmt.Fprintln(os.Stderr, err)
+				os.Exit(2)
+			}
+			ReplFile(terp, r, filename)
+			r.Close()
+		}
+		return
+	}
+	if len(args) > 0 && args[0] == "opt" {
+		// snoc opt [--dump] < program
+		fs := flag.NewFlagSet("opt", flag.ExitOnError)
+		dump := fs.Bool("dump", false, "print optimized forms on stdout")
+		fs.Parse(args[1:])
+		terp.Optimize = true
+		if *dump {
+			terp.OptDump = os.Stdout
+		}
+	}
 
-	results := Repl(NewTerp(), os.Stdin)
+	results := Repl(terp, os.Stdin)
 	for i, result := range results {
 		L("==> result[%d] = %v", i, result)
 	}
 }
+
+// snoc fmt [-w] [-d] [files...] reformats snoc source, like gofmt.
+func fmtMain(args []string) int {
+	fs := flag.NewFlagSet("fmt", flag.ExitOnError)
+	write := fs.Bool("w", false, "write result to (source) file instead of stdout")
+	diff := fs.Bool("d", false, "display diffs instead of rewriting files")
+	fs.Parse(args)
+
+	status := 0
+	if fs.NArg() == 0 {
+		src, err := ioutil.ReadAll(os.Stdin)
+		if err == nil {
+			err = fmtFile("<stdin>", src, false, *diff)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+	}
+	for _, filename := range fs.Args() {
+		src, err := ioutil.ReadFile(filename)
+		if err == nil {
+			err = fmtFile(filename, src, *write, *diff)
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			status = 2
+		}
+	}
+	return status
+}
+
+func fmtFile(filename string, src []byte, write, diff bool) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%s: %v", filename, r)
+		}
+	}()
+	res := []byte(FormatSource(string(src), filename, DefaultWidth))
+	if bytes.Equal(src, res) && (write || diff) {
+		return nil
+	}
+	if diff {
+		f, err := ioutil.TempFile("", "snocfmt")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(f.Name())
+		f.Write(res)
+		f.Close()
+		cmd := exec.Command("diff", "-u", "--label", filename+".orig", "--label", filename, "-", f.Name())
+		cmd.Stdin = bytes.NewReader(src)
+		cmd.Stdout = os.Stdout
+		cmd.Run() // diff exits 1 when files differ.
+		return nil
+	}
+	if write {
+		return ioutil.WriteFile(filename, res, 0644)
+	}
+	_, err = os.Stdout.Write(res)
+	return err
+}
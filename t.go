@@ -1,9 +1,54 @@
 package snoc
 
+import (
+	"context"
+	"io"
+	"text/scanner"
+)
+
 type Any interface{}
 
 type Terp struct {
-	Globals map[*Sym]Any
+	Globals  map[*Sym]Any // The globals of NS.
+	Optimize bool         // Optimize DEFUN bodies and top-level forms.
+	OptDump  io.Writer    // If not nil, print optimized forms here.
+	Out      io.Writer    // Output port for display, write, and format.
+
+	GoComments bool // Read Go-style // and /* */ comments.  NewTerp sets it.
+
+	Where map[*Pair]scanner.Position // Where top-level forms in progress were read.
+	Stack []Frame                    // Lisp call stack, innermost last.
+
+	NS      *Module            // The namespace of top-level forms.
+	Path    []string           // Directories to search for modules.
+	Modules map[string]*Module // Namespaces by name, and modules already required.
+	Loading []*Module          // Modules being required, innermost last.
+
+	Limits Limits // On each EvalString, Call, or top-level REPL form.
+	Used   Usage  // Against the Limits, so far.
+
+	ctx  context.Context // Of the EvalString or Call in progress, if any.
+	runs int             // Nesting of EvalString and Call.
+}
+
+// A Module is a namespace of globals, some of which it exports.
+// The builtins are in "core", and the REPL starts in "user".
+// Others are files that begin with (module name (export sym...)).
+type Module struct {
+	Name     string
+	Filename string
+	Globals  map[*Sym]Any
+	Exports  []*Sym
+	Aliases  map[string]*Module // For qualified symbols like alias/name.
+	Declared bool               // Saw the (module ...) form.
+}
+
+// A Frame on the Lisp call stack is either a Form being evaluated,
+// or the body of a function with a Name.
+type Frame struct {
+	Form  *Pair
+	Name  string
+	Where map[*Pair]scanner.Position // Of the forms in the function's body.
 }
 
 type Env struct {
@@ -11,6 +56,7 @@ type Env struct {
 	Up    *Env
 	Slots []Any
 	Terp  *Terp
+	NS    *Module // Namespace for symbols; if nil, the Terp's.
 }
 
 type ProtoFunc struct {
@@ -20,6 +66,8 @@ type ProtoFunc struct {
 	Body   Any
 	Name   string
 	IsLet  bool
+	NS     *Module                    // Namespace of a top-level defun.
+	Where  map[*Pair]scanner.Position // Of lists in Body; shared with nested ProtoFuncs.
 }
 
 type Func struct {
@@ -30,6 +78,7 @@ type Func struct {
 	Name   string
 	IsLet  bool
 	Proto  *ProtoFunc
+	NS     *Module
 }
 
 type Var struct {
@@ -42,17 +91,66 @@ type Sym struct {
 	S string
 }
 
+// A Keyword like :name evaluates to itself.
+// Keywords are interned apart from symbols; see InternKeyword.
+type Keyword struct {
+	S string
+}
+
 type Pair struct {
 	H Any
 	T *Pair
 }
 
+type Char rune
+
+type Vec struct {
+	V []Any
+}
+
+type Hash struct {
+	M    map[Any]Any
+	Keys []Any // In insertion order, for iteration and printing.
+}
+
+type PMap struct {
+	Root  *hamtNode // nil if empty.
+	Count int
+}
+
+type PVec struct {
+	Count int
+	Shift uint
+	Root  *pvecNode
+	Tail  []Any
+}
+
+type StructType struct {
+	Name   string
+	Fields []*Sym
+}
+
+type Record struct {
+	Type *StructType
+	Vals []Any
+}
+
 type Prim struct {
 	Name string
 	F    func(args []Any, env *Env) Any // args are evaluated.
+	Pure bool                           // No side effects; safe to fold.
 }
 
 type Special struct {
 	Name string
 	F    func(args []Any, env *Env) Any // args are unevaluated.
 }
+
+// Guard evaluates Fast if each of Syms is still bound to the
+// corresponding Wants in the Globals, otherwise it evaluates Slow.
+type Guard struct {
+	Syms  []*Sym
+	Wants []Any
+	Fast  Any
+	Slow  Any
+}
@@ -0,0 +1,80 @@
+// u.go: execution limits
+
+package snoc
+
+import (
+	"fmt"
+)
+
+// Limits bound the work of each EvalString, Call, or top-level REPL form,
+// for running code that might not be trusted.  Zero means no limit.
+type Limits struct {
+	MaxSteps int // Lists evaluated, which includes every call.
+	MaxDepth int // Nested calls of Lisp functions.  Data has MaxNesting.
+	MaxAlloc int // Approximately, list cells, slots, and characters allocated.
+}
+
+// A LimitError says which of the Limits was exceeded.
+// It is the Err of the *Error raised, so errors.As can find it.
+type LimitError struct {
+	Limit string // "steps", "depth", "alloc", or "nesting".
+	Max   int
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("exceeded %s limit of %d", e.Limit, e.Max)
+}
+
+func exceeded(limit string, max int) {
+	e := &LimitError{Limit: limit, Max: max}
+	panic(&Error{Msg: e.Error(), Err: e})
+}
+
+// MaxNesting bounds how deep Equal, Compare, HashCode, printing, and
+// the Reader go into data, so data that contains itself, or source nested
+// too deep, is an error instead of overflowing the Go stack.
+// It applies with or without Limits.
+const MaxNesting = 10000
+
+// nested fails if data is nested deeper than MaxNesting.
+func nested(depth int) {
+	if depth > MaxNesting {
+		exceeded("nesting", MaxNesting)
+	}
+}
+
+// Usage counts work against the Limits.
+type Usage struct {
+	Steps  int
+	Depth  int
+	Allocs int
+}
+
+// step counts evaluating a list.
+func (terp *Terp) step() {
+	terp.Used.Steps++
+	if max := terp.Limits.MaxSteps; max > 0 && terp.Used.Steps > max {
+		exceeded("steps", max)
+	}
+}
+
+// enter counts a call.  The caller restores Used.Depth when it returns.
+func (terp *Terp) enter() {
+	terp.Used.Depth++
+	if max := terp.Limits.MaxDepth; max > 0 && terp.Used.Depth > max {
+		exceeded("depth", max)
+	}
+}
+
+// Alloc counts n units allocated.  Prims folded by the optimizer
+// have no env, and are not counted.
+func Alloc(env *Env, n int) {
+	if env == nil || env.Terp == nil {
+		return
+	}
+	terp := env.Terp
+	terp.Used.Allocs += n
+	if max := terp.Limits.MaxAlloc; max > 0 && terp.Used.Allocs > max {
+		exceeded("alloc", max)
+	}
+}
@@ -0,0 +1,130 @@
+package snoc
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestLimits(t *testing.T) {
+	ctx := context.Background()
+	terp := NewTerp()
+	terp.Limits = Limits{MaxSteps: 1000, MaxDepth: 100, MaxAlloc: 100000}
+	if _, err := terp.EvalString(ctx, `
+		(defun busy (n) (vector-map (fn (x) (+ x 1)) (list->vector (range n))))
+		(defun deep (n) (+ 1 (deep n)))
+		(defun grow (xs) (grow (append xs xs)))
+		(defun count (n) (if (< n 1) 0 (+ 1 (count (- n 1)))))
+		(defun make-big (s) (make-big (string-append s s)))
+	`); err != nil {
+		t.Fatal(err)
+	}
+
+	scenarios := []struct {
+		src   string
+		limit string
+	}{
+		{`(busy 2000)`, "steps"},
+		{`(deep 1)`, "depth"},
+		{`(grow (list 1))`, "alloc"},
+		{`(length (range 1e12))`, "alloc"},
+		{`(string-append "abc" (make-big "abc"))`, "alloc"},
+		{`(string-append "abc" 5)`, ""},
+	}
+	for _, sc := range scenarios {
+		_, err := terp.EvalString(ctx, sc.src)
+		var limit *LimitError
+		switch {
+		case sc.limit == "":
+			if err == nil || errors.As(err, &limit) {
+				t.Errorf("For %s, got %v, wanted an error that is not a limit", sc.src, err)
+			}
+		case !errors.As(err, &limit) || limit.Limit != sc.limit:
+			t.Errorf("For %s, got %v, wanted exceeding the %s limit", sc.src, err, sc.limit)
+		case !strings.Contains(err.Error(), "exceeded "+sc.limit+" limit"):
+			t.Errorf("For %s, got %q", sc.src, err)
+		}
+		if terp.Used.Depth != 0 || len(terp.Stack) != 0 {
+			t.Errorf("After %s, depth %d and stack %v", sc.src, terp.Used.Depth, terp.Stack)
+		}
+	}
+
+	// Each call gets the whole budget, and work within the limits is fine.
+	for i := 0; i < 3; i++ {
+		if z, err := terp.Call(ctx, "count", 90); err != nil || z != 90.0 {
+			t.Errorf("Got %v, %v, wanted 90", z, err)
+		}
+	}
+
+	// The REPL catches a limit, and goes on to the next form.
+	results := Repl(terp, strings.NewReader(`(deep 1) (count 5)`))
+	if got := Stringify(results[0]); !strings.Contains(got, "in deep: exceeded depth limit of 100") {
+		t.Errorf("Got %s", got)
+	}
+	if got := Stringify(results[1]); got != "5" {
+		t.Errorf("Got %s, wanted 5", got)
+	}
+}
+
+func TestNesting(t *testing.T) {
+	ctx := context.Background()
+	terp := NewTerp()
+	v, err := terp.EvalString(ctx, `
+		(defun cyclic () (let v (vector 1 2) (vector-set! v 0 v)))
+		(cyclic)
+	`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Data that contains itself is an error, not a Go stack overflow.
+	for _, src := range []string{
+		`(equal? (cyclic) (cyclic))`,
+		`(compare (cyclic) (cyclic))`,
+		`(hash (cyclic))`,
+		`(write (cyclic))`,
+		`(display (cyclic))`,
+		`(format "~a" (cyclic))`,
+	} {
+		_, err := terp.EvalString(ctx, src)
+		var limit *LimitError
+		if !errors.As(err, &limit) || limit.Limit != "nesting" {
+			t.Errorf("For %s, got %v, wanted exceeding the nesting limit", src, err)
+		}
+	}
+	if _, err := Marshal([]Any{v}); err == nil || !strings.Contains(err.Error(), "exceeded nesting limit") {
+		t.Errorf("Marshal got %v", err)
+	}
+	for name, f := range map[string]func(){
+		"Stringify": func() { Stringify(v) },
+		"PP":        func() { PP(v, DefaultWidth) },
+	} {
+		func() {
+			defer func() {
+				if e, ok := recover().(*Error); !ok || !strings.Contains(e.Msg, "exceeded nesting limit") {
+					t.Errorf("%s got %v", name, e)
+				}
+			}()
+			f()
+		}()
+	}
+
+	// The REPL shows a result that contains itself, and goes on.
+	results := Repl(terp, strings.NewReader(`(cyclic) (+ 2 3)`))
+	if len(results) != 2 || results[1] != 5.0 {
+		t.Fatalf("Got %d results", len(results))
+	}
+	if _, ok := results[0].(*Vec); !ok {
+		t.Errorf("Got %T, wanted the vector", results[0])
+	}
+
+	// Deep data that does not contain itself is fine.
+	deep := Any(NIL)
+	for i := 0; i < MaxNesting; i++ {
+		deep = &Vec{V: []Any{deep}}
+	}
+	if xs := ParseText(Write(deep), "deep"); len(xs) != 1 || !Equal(xs[0], deep) {
+		t.Errorf("Deep data did not read back")
+	}
+}
@@ -0,0 +1,87 @@
+// v.go: vectors
+
+package snoc
+
+import (
+	"math"
+
+	. "github.com/strickyak/yak"
+)
+
+func ToVec(o Any) *Vec {
+	switch t := o.(type) {
+	case *Vec:
+		return t
+	}
+	Throw(o, "cannot Vec")
+	return nil
+}
+
+// ToIndex converts a number to an int index in [0, n).
+func ToIndex(o Any, n int) int {
+	f := ToFloat(o)
+	if f != math.Trunc(f) || f < 0 || f >= float64(n) {
+		Throw(o, "index out of range [0, %d)", n)
+	}
+	return int(f)
+}
+
+var BuiltinVectorPrims = map[string]func([]Any, *Env) Any{
+	"vector": func(args []Any, env *Env) Any {
+		return &Vec{V: append([]Any(nil), args...)}
+	},
+	"vector?": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		_, ok := args[0].(*Vec)
+		return LispyBool(ok)
+	},
+	"vector-length": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		return float64(len(ToVec(args[0]).V))
+	},
+	"vector-ref": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		v := ToVec(args[0])
+		return v.V[ToIndex(args[1], len(v.V))]
+	},
+	"vector-set!": func(args []Any, env *Env) Any {
+		MustLen(args, 3)
+		v := ToVec(args[0])
+		v.V[ToIndex(args[1], len(v.V))] = args[2]
+		return args[2]
+	},
+	"vector->list": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ToVec(args[0])
+		Alloc(env, len(v.V))
+		return VecToList(v.V)
+	},
+	"list->vector": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		v := ListToVec(args[0])
+		Alloc(env, len(v))
+		return &Vec{V: v}
+	},
+	"vector-map": func(args []Any, env *Env) Any {
+		MustLen(args, 2)
+		v := ToVec(args[1])
+		Alloc(env, len(v.V))
+		z := make([]Any, len(v.V))
+		for i, e := range v.V {
+			z[i] = ApplyValues(args[0], []Any{e}, env)
+		}
+		return &Vec{V: z}
+	},
+	// (vector-slice v start) or (vector-slice v start end) copies like v[start:end].
+	"vector-slice": func(args []Any, env *Env) Any {
+		Must(len(args) == 2 || len(args) == 3)
+		v := ToVec(args[0])
+		end := len(v.V)
+		if len(args) == 3 {
+			end = ToIndex(args[2], len(v.V)+1)
+		}
+		start := ToIndex(args[1], end+1)
+		Alloc(env, end-start)
+		return &Vec{V: append([]Any(nil), v.V[start:end]...)}
+	},
+}
@@ -0,0 +1,38 @@
+package snoc
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestVectorEdges(t *testing.T) {
+	scenarios := []struct {
+		program string
+		want    string
+	}{
+		{`(vector-ref [10 20 30] 2)`, "30"},
+		{`(vector-ref [10 20 30] 3)`, "*ERROR* *repl*:1:1: index out of range [0, 3) 3"},
+		{`(vector-ref [10 20 30] -1)`, "*ERROR* *repl*:1:1: index out of range [0, 3) -1"},
+		{`(vector-ref [10 20 30] 1.5)`, "*ERROR* *repl*:1:1: index out of range [0, 3) 1.5"},
+		{`(vector-ref [] 0)`, "*ERROR* *repl*:1:1: index out of range [0, 0) 0"},
+		{`(vector-ref (list 1 2) 0)`, "*ERROR* *repl*:1:1: cannot Vec (1 2)"},
+		{`(vector-set! (vector 1 2) 2 3)`, "*ERROR* *repl*:1:1: index out of range [0, 2) 2"},
+		{`(vector-length [])`, "0"},
+		{`(vector-slice [1 2 3] 3)`, "[]"},
+		{`(vector-slice [1 2 3] 1 1)`, "[]"},
+		{`(vector-slice [1 2 3] 2 1)`, "*ERROR* *repl*:1:1: index out of range [0, 2) 2"},
+		{`(vector-slice [1 2 3] 0 4)`, "*ERROR* *repl*:1:1: index out of range [0, 4) 4"},
+		{`(vector-map list [])`, "[]"},
+		{`(list->vector nil)`, "[]"},
+		{`(vector->list [])`, "()"},
+		{`[1 (+ 1 1) [3]]`, "[1 2 [3]]"},
+		{`[1 2`, "*ERROR* *repl*:1:1: incomplete form"},
+		{`[1 2)`, "*ERROR* *repl*:1:5: expected ']' but got ')'"},
+	}
+	for _, sc := range scenarios {
+		results := Repl(NewTerp(), strings.NewReader(sc.program))
+		if got := Stringify(results[len(results)-1]); got != sc.want {
+			t.Errorf("For %s, got %s, wanted %s", sc.program, got, sc.want)
+		}
+	}
+}
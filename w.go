@@ -0,0 +1,293 @@
+// w.go: printing
+
+package snoc
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	. "github.com/strickyak/yak"
+)
+
+// Display shows strings and characters raw, for humans.
+func Display(x Any) string {
+	var buf strings.Builder
+	printTo(&buf, x, false, 0)
+	return buf.String()
+}
+
+// Write shows data in reader syntax, so ParseText(Write(x)) is Equal to x.
+// Objects that cannot be read back, like functions and records,
+// print as #<func name> or #<point x=1 y=2>, which the reader rejects;
+// the write prim fails on them instead (see readable).
+func Write(x Any) string {
+	var buf strings.Builder
+	printTo(&buf, x, true, 0)
+	return buf.String()
+}
+
+// printTo prints x, which is at depth within the data being printed.
+func printTo(buf *strings.Builder, x Any, readable bool, depth int) {
+	nested(depth)
+	printAll := func(open string, xs []Any, close string) {
+		buf.WriteString(open)
+		for i, e := range xs {
+			if i > 0 {
+				buf.WriteByte(' ')
+			}
+			printTo(buf, e, readable, depth+1)
+		}
+		buf.WriteString(close)
+	}
+
+	switch t := x.(type) {
+	case string:
+		if readable {
+			buf.WriteString(strconv.Quote(t))
+		} else {
+			buf.WriteString(t)
+		}
+	case Char:
+		if readable {
+			buf.WriteString(t.String())
+		} else {
+			buf.WriteRune(rune(t))
+		}
+	case float64:
+		buf.WriteString(strconv.FormatFloat(t, 'g', -1, 64))
+	case *Sym:
+		if readable && SymNeedsBars(t.S) {
+			buf.WriteString(BarSym(t.S))
+		} else {
+			buf.WriteString(t.S)
+		}
+	case *Keyword:
+		if readable && SymNeedsBars(t.S) {
+			buf.WriteString(":" + BarSym(t.S))
+		} else {
+			buf.WriteString(":" + t.S)
+		}
+	case *Pair:
+		printAll("(", ListToVec(t), ")")
+	case *Vec:
+		printAll("[", t.V, "]")
+	case *PVec:
+		printAll("#pvec[", t.ToSlice(), "]")
+	case *Hash:
+		printAll("{", hashEntries(t), "}")
+	case *PMap:
+		printAll("#pmap{", pmapEntries(t), "}")
+	case *Record:
+		fmt.Fprintf(buf, "#<%s", t.Type.Name)
+		for i, field := range t.Type.Fields {
+			fmt.Fprintf(buf, " %s=", field.S)
+			printTo(buf, t.Vals[i], readable, depth+1)
+		}
+		buf.WriteString(">")
+	case *Func:
+		fmt.Fprintf(buf, "#<func %s>", t.Name)
+	case *ProtoFunc:
+		fmt.Fprintf(buf, "#<func %s>", t.Name)
+	case *Prim:
+		fmt.Fprintf(buf, "#<prim %s>", t.Name)
+	case *Special:
+		fmt.Fprintf(buf, "#<special %s>", t.Name)
+	case int:
+		buf.WriteString(strconv.Itoa(t))
+	default:
+		if readable {
+			fmt.Fprintf(buf, "#<go %T>", t)
+		} else {
+			buf.WriteString(Stringify(x))
+		}
+	}
+}
+
+// readable fails if x, not evaluated, would not read back as the same data.
+// x is at depth within the data being checked.
+func readable(x Any, depth int) {
+	nested(depth)
+	switch t := x.(type) {
+	case *Keyword, *Sym, Char, string, float64:
+	case *Pair:
+		for p := t; p != NIL; p = p.T {
+			readable(p.H, depth+1)
+		}
+	case *Vec:
+		for _, e := range t.V {
+			readable(e, depth+1)
+		}
+	case *Hash:
+		for _, k := range t.Keys {
+			readable(k, depth+1)
+			readable(t.M[k], depth+1)
+		}
+	case *PMap:
+		t.Each(func(k, v Any) {
+			readable(k, depth+1)
+			readable(v, depth+1)
+		})
+	case *PVec:
+		for _, e := range t.ToSlice() {
+			readable(e, depth+1)
+		}
+	default:
+		Throw(x, "cannot write as readable snoc data:")
+	}
+}
+
+// SymNeedsBars tells if a symbol would not read back as itself without bars.
+func SymNeedsBars(s string) bool {
+	if s == "" || s == "nil" || !utf8.ValidString(s) {
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	for i, r := range s {
+		switch r {
+		case '(', ')', '[', ']', '{', '}', '|', '"', ';':
+			return true
+		case '/', '`', '#', ':':
+			if i == 0 {
+				return true
+			}
+		}
+		if r <= ' ' || !unicode.IsGraphic(r) {
+			return true
+		}
+	}
+	return false
+}
+
+// BarSym puts a symbol name in bars, escaping \ and | with a backslash,
+// and other non-graphic runes as \x41; (hex digits and a semicolon).
+func BarSym(s string) string {
+	var buf strings.Builder
+	buf.WriteByte('|')
+	for _, r := range s {
+		switch {
+		case r == '\\' || r == '|':
+			buf.WriteByte('\\')
+			buf.WriteRune(r)
+		case r != ' ' && !unicode.IsGraphic(r):
+			fmt.Fprintf(&buf, `\x%x;`, r)
+		default:
+			buf.WriteRune(r)
+		}
+	}
+	buf.WriteByte('|')
+	return buf.String()
+}
+
+// UnbarSym undoes BarSym.
+func UnbarSym(s string) string {
+	var buf strings.Builder
+	rs := []rune(s[1 : len(s)-1])
+	for i := 0; i < len(rs); i++ {
+		if rs[i] == '\\' && i+1 < len(rs) {
+			i++
+			if rs[i] == 'x' {
+				end := i + 1
+				for end < len(rs) && rs[end] != ';' {
+					end++
+				}
+				n, err := strconv.ParseUint(string(rs[i+1:end]), 16, 32)
+				if err != nil || end == len(rs) {
+					Throw(s, "bad \\x escape in symbol")
+				}
+				buf.WriteRune(rune(n))
+				i = end
+				continue
+			}
+		}
+		buf.WriteRune(rs[i])
+	}
+	return buf.String()
+}
+
+// Format interprets directives ~a (display), ~s (write),
+// ~d (number), ~% (newline), and ~~ (tilde).
+func Format(format string, args []Any) string {
+	var buf strings.Builder
+	next := func() Any {
+		if len(args) == 0 {
+			Throw(format, "format: not enough args")
+		}
+		a := args[0]
+		args = args[1:]
+		return a
+	}
+	rs := []rune(format)
+	for i := 0; i < len(rs); i++ {
+		if rs[i] != '~' {
+			buf.WriteRune(rs[i])
+			continue
+		}
+		i++
+		if i == len(rs) {
+			Throw(format, "format: ends with ~")
+		}
+		switch rs[i] {
+		case 'a', 'A':
+			printTo(&buf, next(), false, 0)
+		case 's', 'S':
+			printTo(&buf, next(), true, 0)
+		case 'd', 'D':
+			printTo(&buf, ToFloat(next()), false, 0)
+		case '%':
+			buf.WriteByte('\n')
+		case '~':
+			buf.WriteByte('~')
+		default:
+			Throw(format, "format: unknown directive ~%c", rs[i])
+		}
+	}
+	if len(args) > 0 {
+		Throw(VecToList(args), "format: too many args")
+	}
+	return buf.String()
+}
+
+func output(env *Env, s string) {
+	if _, err := io.WriteString(env.Terp.Out, s); err != nil {
+		Throw(s, "cannot write output: %v", err)
+	}
+}
+
+var BuiltinOutputPrims = map[string]func([]Any, *Env) Any{
+	"display": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		output(env, Display(args[0]))
+		return NIL
+	},
+	// (write x) shows x in reader syntax, failing if it cannot be read back.
+	"write": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		readable(args[0], 0)
+		output(env, Write(args[0]))
+		return NIL
+	},
+	// (print x) is write followed by newline.
+	"print": func(args []Any, env *Env) Any {
+		MustLen(args, 1)
+		readable(args[0], 0)
+		output(env, Write(args[0])+"\n")
+		return NIL
+	},
+	"newline": func(args []Any, env *Env) Any {
+		MustLen(args, 0)
+		output(env, "\n")
+		return NIL
+	},
+	// (format "~a is ~s~%" x y) writes to the output port.
+	"format": func(args []Any, env *Env) Any {
+		Must(len(args) >= 1)
+		output(env, Format(ToStr(args[0]), args[1:]))
+		return NIL
+	},
+}
@@ -0,0 +1,168 @@
+package snoc
+
+import (
+	"math"
+	"strings"
+	"testing"
+)
+
+// valueGen builds a value from fuzz bytes.
+// It makes no records or functions, which Write cannot round-trip.
+type valueGen struct {
+	data []byte
+}
+
+func (g *valueGen) next() byte {
+	if len(g.data) == 0 {
+		return 0
+	}
+	b := g.data[0]
+	g.data = g.data[1:]
+	return b
+}
+
+func (g *valueGen) str() string {
+	rs := make([]rune, g.next()%8)
+	for i := range rs {
+		rs[i] = rune(g.next())<<8 | rune(g.next())
+	}
+	return string(rs)
+}
+
+var trickySymbolNames = []string{
+	"", "nil", "1", "-2.5e3", "inf", "NaN", "0x10", "a b", "|", `\`, "(", "}",
+	"#x", `#\a`, "/", "//", "a/b", "`q", `"q"`, "x|y", "x\ny", "call/cc",
+	":", ":a", "a:b",
+}
+
+func (g *valueGen) key() Any {
+	switch g.next() % 5 {
+	case 3:
+		return InternKeyword(g.str())
+	case 0:
+		return float64(int8(g.next()))
+	case 1:
+		return g.str()
+	case 2:
+		return Char(g.next())
+	}
+	return Intern(g.str())
+}
+
+func (g *valueGen) value(depth int) Any {
+	b := g.next()
+	if depth > 3 {
+		b %= 6 // Only atoms.
+	}
+	switch b % 11 {
+	case 0:
+		return NIL
+	case 1:
+		specials := []float64{math.Inf(1), math.Inf(-1), math.NaN(), math.Copysign(0, -1), 1e300, 5e-324}
+		return specials[int(g.next())%len(specials)]
+	case 2:
+		return float64(int16(g.next())<<8|int16(g.next())) / 8
+	case 3:
+		return g.str()
+	case 4:
+		name := g.str()
+		if g.next()%2 == 0 {
+			name = trickySymbolNames[int(g.next())%len(trickySymbolNames)]
+		}
+		if g.next()%3 == 0 {
+			return InternKeyword(name)
+		}
+		return Intern(name)
+	case 5:
+		return Char(rune(g.next())<<8 | rune(g.next()))
+	}
+	n := int(g.next() % 5)
+	var xs []Any
+	for i := 0; i < n; i++ {
+		xs = append(xs, g.value(depth+1))
+	}
+	switch b % 11 {
+	case 6:
+		return VecToList(xs)
+	case 7:
+		return &Vec{V: xs}
+	case 8:
+		h := NewHash(nil)
+		for _, x := range xs {
+			h.Set(g.key(), x)
+		}
+		return h
+	case 9:
+		m := EmptyPMap
+		for _, x := range xs {
+			m = m.Assoc(g.value(depth+1), x)
+		}
+		return m
+	}
+	return pvecConj(EmptyPVec, xs)
+}
+
+func checkRoundTrip(t *testing.T, x Any) {
+	s := Write(x)
+	var xs []Any
+	func() {
+		defer func() {
+			if r := recover(); r != nil {
+				t.Fatalf("Cannot read back %q: %v", s, r)
+			}
+		}()
+		xs = ParseText(s, "checkRoundTrip")
+	}()
+	if len(xs) != 1 || !Equal(xs[0], x) {
+		t.Fatalf("Wrote %q but read back %v", s, VecToList(xs))
+	}
+}
+
+func TestWriteRoundTrip(t *testing.T) {
+	for _, name := range trickySymbolNames {
+		checkRoundTrip(t, Intern(name))
+		checkRoundTrip(t, InternKeyword(name))
+	}
+	checkRoundTrip(t, "tab\tquote\"backslash\\bell\a\xff")
+	checkRoundTrip(t, VecToList([]Any{Char(' '), Char('('), Char('\\'), Char(0), Char(0x2028), Char('λ')}))
+	checkRoundTrip(t, NewHash([]Any{Intern("a"), &Vec{V: []Any{1.0, NIL}}, "b", EmptyPVec.Conj(2.0)}))
+	checkRoundTrip(t, EmptyPMap.Assoc(VecToList([]Any{1.0}), EmptyPMap))
+
+	if got := Write(&Prim{Name: "head"}); got != "#<prim head>" {
+		t.Errorf("Got %q", got)
+	}
+}
+
+func FuzzWriteRoundTrip(f *testing.F) {
+	f.Add([]byte{})
+	f.Add([]byte{6, 4, 3, 1, 2, 4, 0, 5, 4, 1, 200, 3})
+	f.Add([]byte{7, 3, 8, 2, 1, 3, 9, 1, 6, 2, 10, 2, 5, 0, 40})
+	f.Fuzz(func(t *testing.T, data []byte) {
+		g := &valueGen{data: data}
+		checkRoundTrip(t, g.value(0))
+	})
+}
+
+// TestWriteUnreadable checks that write fails on records and functions,
+// which cannot be read back, while display shows them.
+func TestWriteUnreadable(t *testing.T) {
+	var out strings.Builder
+	terp := NewTerp()
+	terp.Out = &out
+	results := Repl(terp, strings.NewReader(`
+		(defstruct point x y)
+		(display (make-point 1 2))
+		(write (list (make-point 1 2)))
+		(print head)
+		(write (list 1 #pvec[:a "b"]))
+	`))
+	if got := Stringify(results[2]); got != "*ERROR* *repl*:4:3: cannot write as readable snoc data: #<point x=1 y=2>" {
+		t.Errorf("Got %s", got)
+	}
+	if got := Stringify(results[3]); got != "*ERROR* *repl*:5:3: cannot write as readable snoc data: #<prim head>" {
+		t.Errorf("Got %s", got)
+	}
+	if got, want := out.String(), `#<point x=1 y=2>(1 #pvec[:a "b"])`; got != want {
+		t.Errorf("Got output %q, wanted %q", got, want)
+	}
+}
@@ -0,0 +1,103 @@
+// x.go: errors with source positions and Lisp backtraces
+
+package snoc
+
+import (
+	"fmt"
+	"strings"
+	"unicode/utf8"
+)
+
+// An Error is a runtime error in Lisp code.
+// Throw makes one with just a Msg, and Terp.ErrorFrom fills in the rest.
+type Error struct {
+	Msg   string
+	Where string   // Source position of the innermost form, if known.
+	In    string   // Name of the innermost function, if any.
+	Trace []string // Lisp backtrace, innermost call first.
+	Err   error    // The Go error that caused it, if any.
+}
+
+// Error reads like "foo.snoc:12:5: in my-sum: cannot Head 3",
+// followed by the backtrace, one call per line.
+func (e *Error) Error() string {
+	var buf strings.Builder
+	buf.WriteString(placed(e.Where, e.In, e.Msg))
+	for _, t := range e.Trace {
+		buf.WriteString("\n\t")
+		buf.WriteString(t)
+	}
+	return buf.String()
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func placed(where, in, msg string) string {
+	if in != "" {
+		msg = "in " + in + ": " + msg
+	}
+	if where != "" {
+		msg = where + ": " + msg
+	}
+	return msg
+}
+
+// ErrorFrom converts something recovered from a panic in Eval into an *Error,
+// adding where it happened from the Lisp call stack, which it then clears.
+func (terp *Terp) ErrorFrom(r interface{}) *Error {
+	stack := terp.Stack
+	terp.Stack = nil
+
+	e, ok := r.(*Error)
+	if err, isErr := r.(error); isErr && !ok {
+		e = &Error{Msg: err.Error(), Err: err}
+	} else if !ok {
+		e = &Error{Msg: fmt.Sprint(r)}
+	} else if e.Where != "" || e.In != "" || e.Trace != nil {
+		return e // Already placed.
+	}
+
+	// where finds the nearest position at or below stack[i],
+	// and the function it is in, which knows the positions of its forms.
+	where := func(i int) (string, string) {
+		var forms []*Pair
+		positions, in := terp.Where, ""
+		for ; i >= 0; i-- {
+			if f := stack[i]; f.Name != "" {
+				positions, in = f.Where, f.Name
+				break
+			}
+			forms = append(forms, stack[i].Form)
+		}
+		for _, form := range forms {
+			if p, ok := positions[form]; ok {
+				return p.String(), in
+			}
+		}
+		return "", in
+	}
+
+	e.Where, e.In = where(len(stack) - 1)
+	for i := len(stack) - 1; i >= 0; i-- {
+		if stack[i].Name == "" {
+			continue
+		}
+		j := i - 1 // The form that called it.
+		if j < 0 || stack[j].Form == nil {
+			continue // Called from Go.
+		}
+		pos, in := where(j)
+		e.Trace = append(e.Trace, placed(pos, in, abbrev(DumpString(stack[j].Form), 60)))
+	}
+	return e
+}
+
+// abbrev shortens s to at most n runes.
+func abbrev(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n-3]) + "..."
+}
@@ -0,0 +1,65 @@
+package snoc
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestErrorPositions(t *testing.T) {
+	program := `
+(defun my-sum (aList)
+  (if (null? aList) 0
+      (+ (head aList)
+         (my-sum (tail aList)))))
+(defun go (x) (my-sum x))
+(go (list 1 2 4))
+(my-sum (list 1 oops 2))
+`
+	terp := NewTerp()
+	results := ReplFile(terp, strings.NewReader(program), "foo.snoc")
+	if got := Stringify(results[2]); got != "7" {
+		t.Errorf("Got %s, wanted 7", got)
+	}
+	got := Stringify(results[3])
+	want := "*ERROR* foo.snoc:8:9: cannot Eval symbol oops"
+	if got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+
+	results = ReplFile(terp, strings.NewReader("\n(go 3)\n"), "bar.snoc")
+	got = Stringify(results[0])
+	want = `*ERROR* foo.snoc:4:10: in my-sum: cannot Head 3
+	foo.snoc:6:15: in go: (my-sum x)
+	bar.snoc:2:1: (go 3)`
+	if got != want {
+		t.Errorf("Got %q, wanted %q", got, want)
+	}
+	if len(terp.Stack) != 0 {
+		t.Errorf("Stack was not cleared: %v", terp.Stack)
+	}
+}
+
+// TestWhereIsForgotten checks that positions do not pile up in a long-running Terp.
+func TestWhereIsForgotten(t *testing.T) {
+	terp := NewTerp()
+	for i := 0; i < 3; i++ {
+		results := Repl(terp, strings.NewReader(`
+(defun f (x)
+  (let y (list x)
+    (head (head y))))
+(list (quote (a b)) [(list 1)] #pvec[(list 2)] #pmap{:k (list 3)})
+(f 1)
+(list 1 ] (f 2))
+(f`))
+		if got := Stringify(results[2]); !strings.HasPrefix(got, "*ERROR* *repl*:4:5: in f: cannot Head 1") {
+			t.Errorf("Got %s", got)
+		}
+	}
+	if _, err := terp.EvalString(context.Background(), `(f 3)`); err == nil || !strings.HasPrefix(err.Error(), "*repl*:4:5: in f: cannot Head 3\n\t*eval*:1:1: (f 3)") {
+		t.Errorf("Got %v", err)
+	}
+	if len(terp.Where) != 0 {
+		t.Errorf("Still remembering %d positions", len(terp.Where))
+	}
+}